@@ -0,0 +1,185 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the audit log of the accesses to the pprof service.
+package pprof4svc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditKind is the kind of an audit event.
+type AuditKind string
+
+// Kinds of audit events.
+const (
+	AuditLogin       AuditKind = "login"        // A login succeeded
+	AuditLoginFailed AuditKind = "login-failed" // A login failed, or was refused to a locked out client
+	AuditAuthFailed  AuditKind = "auth-failed"  // A request to a prefixed route failed to authenticate
+	AuditAccess      AuditKind = "access"       // An authenticated request to an endpoint was served
+	AuditRuntime     AuditKind = "runtime"      // An authenticated request changed the state of the runtime
+	AuditLogout      AuditKind = "logout"       // A session was revoked
+	AuditShare       AuditKind = "share"        // A share link was minted
+)
+
+// AuditEvent is an event of the audit log.
+type AuditEvent struct {
+	Time      time.Time     `json:"time"`                // Time the request was received at
+	Kind      AuditKind     `json:"kind"`                // Kind of the event
+	Principal string        `json:"principal,omitempty"` // Name of the authenticated principal, if any
+	Client    string        `json:"client"`              // Address of the client, from behind the trusted proxies
+	Method    string        `json:"method"`              // Method of the request
+	Route     string        `json:"route"`               // Route of the request, relative to the prefix, or the entrypoint
+	Params    url.Values    `json:"params,omitempty"`    // Query parameters of the request, without credentials
+	Status    int           `json:"status"`              // Status of the response
+	Duration  time.Duration `json:"duration"`            // Time taken to serve the request, in nanoseconds
+	Bytes     int64         `json:"bytes"`               // Size of the response body
+}
+
+// AuditSink receives the audit events. It is called synchronously as requests complete,
+// so it should hand slow work, such as network I/O, off to another goroutine.
+type AuditSink interface {
+	Audit(event AuditEvent)
+}
+
+// AuditFunc is an AuditSink calling a function.
+type AuditFunc func(event AuditEvent)
+
+// Audit calls f(event).
+func (f AuditFunc) Audit(event AuditEvent) {
+	f(event)
+}
+
+// auditLog keeps the most recent audit events in a ring buffer.
+type auditLog struct {
+	mu     sync.Mutex
+	events []AuditEvent // Ring buffer of the events
+	next   int          // Index the next event is written to
+	full   bool         // Whether the buffer wrapped around
+}
+
+// add adds an event, overwriting the oldest one if the buffer is full.
+func (l *auditLog) add(event AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) == 0 {
+		return
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	l.full = l.full || l.next == 0
+}
+
+// recent returns the events, most recent first.
+func (l *auditLog) recent() []AuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.events)
+	}
+	events := make([]AuditEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		events = append(events, l.events[(l.next-i+len(l.events))%len(l.events)])
+	}
+	return events
+}
+
+// audit completes an event of a request with the client, method and parameters of the request, its principal
+// unless set, and the time taken since the event time, then records it in the recent events and with every sink.
+func (p *plugin) audit(r *http.Request, event AuditEvent) {
+	event.Client, event.Method, event.Duration = p.client(r), r.Method, time.Since(event.Time)
+	if principal, ok := PrincipalFromContext(r.Context()); ok && event.Principal == "" {
+		event.Principal = principal.Name
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		query.Del(shareSig)
+		event.Params = query
+	}
+	p.audits.add(event)
+	for _, sink := range p.auditSinks {
+		sink.Audit(event)
+	}
+}
+
+// auditWriter is a response writer recording the status and the size of the response, for the audit log.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *auditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, if the wrapped response writer does.
+func (w *auditWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped response writer, for http.ResponseController.
+func (w *auditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusOf returns the status of a response, 200 if none was written.
+func (w *auditWriter) statusOf() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// auditLog0 serves the most recent audit events, most recent first, as text or JSON.
+func (p *plugin) auditLog0(w http.ResponseWriter, r *http.Request) {
+	events := p.audits.recent()
+	if p.json(r) {
+		writeJSON(w, http.StatusOK, events)
+		return
+	}
+	var b strings.Builder
+	for _, e := range events {
+		route := e.Route
+		if len(e.Params) > 0 {
+			route += "?" + e.Params.Encode()
+		}
+		principal := e.Principal
+		if principal == "" {
+			principal = "-"
+		}
+		fmt.Fprintf(&b, "%s %s %s %s %s %s %d %s %d\n", e.Time.Format(time.RFC3339), e.Kind, principal, e.Client,
+			e.Method, route, e.Status, e.Duration.Round(time.Microsecond), e.Bytes)
+	}
+	writeText(w, http.StatusOK, b.String())
+}
@@ -0,0 +1,44 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the audit sink writing to a log/slog logger, available from Go 1.21.
+package pprof4svc
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogAuditSink returns an AuditSink writing every event to the logger at the Info level,
+// or at the Warn level for failed logins and authentications.
+func SlogAuditSink(logger *slog.Logger) AuditSink {
+	return AuditFunc(func(event AuditEvent) {
+		level := slog.LevelInfo
+		if event.Kind == AuditLoginFailed || event.Kind == AuditAuthFailed {
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(context.Background(), level, "pprof4svc audit",
+			slog.Time("received", event.Time),
+			slog.String("kind", string(event.Kind)),
+			slog.String("principal", event.Principal),
+			slog.String("client", event.Client),
+			slog.String("method", event.Method),
+			slog.String("route", event.Route),
+			slog.String("params", event.Params.Encode()),
+			slog.Int("status", event.Status),
+			slog.Duration("duration", event.Duration),
+			slog.Int64("bytes", event.Bytes),
+		)
+	})
+}
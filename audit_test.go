@@ -0,0 +1,113 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	tests := []struct {
+		size, events int
+		want         []int // Events returned by recent, by the value of their status
+	}{
+		{0, 3, []int{}},
+		{3, 0, []int{}},
+		{3, 2, []int{2, 1}},
+		{3, 3, []int{3, 2, 1}},
+		{3, 4, []int{4, 3, 2}},
+		{3, 7, []int{7, 6, 5}},
+		{1, 5, []int{5}},
+	}
+	for _, test := range tests {
+		l := &auditLog{events: make([]AuditEvent, test.size)}
+		for i := 1; i <= test.events; i++ {
+			l.add(AuditEvent{Status: i})
+		}
+		got := []int{}
+		for _, event := range l.recent() {
+			got = append(got, event.Status)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("size %d, %d events: got %v, want %v", test.size, test.events, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("size %d, %d events: got %v, want %v", test.size, test.events, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	var sunk []AuditEvent
+	p, err := Plugin("token", WithAuditSinks(AuditFunc(func(event AuditEvent) { sunk = append(sunk, event) })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, route := p.prefixes()[0], p.routes.Pprof+"heap"
+	query := shareQuery(t, p, route, url.Values{"debug": {"1"}}, time.Minute, false)
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		kind   AuditKind
+		status int
+		params url.Values
+	}{
+		{"access", prefix + p.routes.Mem + "?json=true", "token", AuditAccess, http.StatusOK, url.Values{"json": {"true"}}},
+		{"rejected credential", prefix + p.routes.Mem, "wrong", AuditAuthFailed, http.StatusForbidden, nil},
+		{"no credential", prefix + p.routes.GC, "", AuditAuthFailed, http.StatusUnauthorized, nil},
+		{"share link", prefix + route + "?" + query.Encode(), "", AuditAccess, http.StatusOK, url.Values{"debug": {"1"}}},
+		{"share link on the stable route", route + "?" + query.Encode(), "", AuditAuthFailed, http.StatusForbidden, url.Values{"debug": {"1"}}},
+		{"minted share link", prefix + p.routes.Share + "?route=" + url.QueryEscape(route), "token", AuditShare, http.StatusOK, url.Values{"route": {route}}},
+	}
+	for _, test := range tests {
+		sunk = nil
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if len(sunk) != 1 {
+			t.Errorf("%s: got %d events, want 1", test.name, len(sunk))
+			continue
+		}
+		event := sunk[0]
+		if event.Kind != test.kind || event.Status != test.status || event.Status != w.Code || event.Bytes != int64(w.Body.Len()) {
+			t.Errorf("%s: got a %s event with status %d and %d bytes, want a %s event with status %d and %d bytes",
+				test.name, event.Kind, event.Status, event.Bytes, test.kind, test.status, w.Body.Len())
+		}
+		// The signature of a share link, which would let anyone reading the audit log use it, is never recorded
+		if event.Params.Has(shareSig) {
+			t.Errorf("%s: got the share signature in the params", test.name)
+		}
+		for key, values := range test.params {
+			if event.Params.Get(key) != values[0] {
+				t.Errorf("%s: got params %v, want %s=%s", test.name, event.Params, key, values[0])
+			}
+		}
+		if recent := p.audits.recent(); len(recent) == 0 || recent[0].Kind != event.Kind || recent[0].Route != event.Route {
+			t.Errorf("%s: got recent events %v, want the event first", test.name, recent)
+		}
+	}
+	if n := len(p.audits.recent()); n != len(tests) {
+		t.Errorf("recent events: got %d, want %d", n, len(tests))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the authentication layer that guards every prefixed route of the pprof service.
+package pprof4svc
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+// equal reports whether a and b are equal, in constant time with respect to their contents.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// match returns the index of the token a credential equals, or -1 if it equals none; empty tokens never match.
+// It compares with every token, so that the time taken does not tell which one matched.
+func match(credential string, tokens []string) int {
+	matched := -1
+	for i, token := range tokens {
+		if equal(credential, token) && token != "" {
+			matched = i
+		}
+	}
+	return matched
+}
+
+// authenticate consults the authenticators in order and returns the principal of the first one accepting
+// the request. If none accepts it, it returns the error of the first one rejecting it, or a nil principal
+// and a nil error if none of them handles the credential of the request.
+func (p *plugin) authenticate(r *http.Request) (*Principal, error) {
+	var err error
+	for _, authenticator := range p.authenticators {
+		principal, err0 := authenticator.Authenticate(r)
+		if principal != nil && err0 == nil {
+			return principal, nil
+		}
+		if err == nil {
+			err = err0
+		}
+	}
+	return nil, err
+}
+
+// auth validates the credential of a request to the given route under the given prefix, and reports whether
+// it is valid. A request made with a share link is accepted if the link is valid for the route; any other request
+// is accepted if it carries a valid session cookie issued by the login, or else a credential accepted by the
+// authenticators. The returned request carries its principal in its context.
+// A session cookie that fails verification, e.g. issued by another replica with a different key, expired or revoked,
+// is deleted and counts as no credential. Requests without a credential get 401, requests with an invalid,
+// expired or rejected one get 403, and count as failures towards the lockout of their client, which then gets 429.
+func (p *plugin) auth(w http.ResponseWriter, r *http.Request, base, prefix, route string) (*http.Request, bool) {
+	client := p.client(r)
+	if query := r.URL.Query(); query.Has(shareSig) {
+		if retry, locked := p.lockout.locked(client); locked {
+			tooManyRequests(w, retry)
+			return r, false
+		}
+		principal, err := p.verifyShare(route, query)
+		if err != nil {
+			p.lockout.fail(client)
+			serveError(w, http.StatusForbidden, "Forbidden")
+			return r, false
+		}
+		return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)), true
+	}
+	var principal *Principal
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if principal, _, _ = p.parseSession(prefix, cookie.Value); principal == nil {
+			setSession(w, r, base+prefix, "", time.Time{})
+		}
+	}
+	if principal == nil {
+		// Clients locked out for failing to authenticate keep valid sessions, but cannot try other credentials
+		if retry, locked := p.lockout.locked(client); locked {
+			tooManyRequests(w, retry)
+			return r, false
+		}
+		var err error
+		principal, err = p.authenticate(r)
+		if err != nil {
+			p.lockout.fail(client)
+			serveError(w, http.StatusForbidden, "Forbidden")
+			return r, false
+		}
+		if principal == nil {
+			for _, authenticator := range p.authenticators {
+				if c, ok := authenticator.(challenger); ok {
+					w.Header().Add("WWW-Authenticate", c.challenge())
+				}
+			}
+			serveError(w, http.StatusUnauthorized, "Unauthorized")
+			return r, false
+		}
+		p.lockout.succeed(client)
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)), true
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the Authenticator interface and its built-in strategies.
+package pprof4svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredential is returned by the built-in authenticators for a request whose credential they
+// recognize but reject.
+var ErrInvalidCredential = errors.New("pprof4svc: invalid credential")
+
+// Principal is the identity of an authenticated client.
+type Principal struct {
+	Name    string    // Name of the client, e.g. a user name or the name of a token
+	Scopes  []Scope   // Scopes granted to the client; nil grants every scope
+	Expires time.Time // Time the credential of the client expires at, bounding its session; none if zero
+}
+
+// Authenticator authenticates the requests to the plugin.
+//
+// Authenticate returns the principal of a request it accepts. It returns a nil principal and a nil error
+// if the request carries no credential it handles, and an error if it rejects the credential of the request.
+// Either way the next authenticator is consulted; a request is rejected if none accepts it and one rejected it.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthFunc is an Authenticator calling a function, e.g. to delegate to an existing user system.
+type AuthFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate calls f(r).
+func (f AuthFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// challenger is implemented by authenticators that tell clients how to authenticate,
+// through the WWW-Authenticate header of a 401 response.
+type challenger interface {
+	challenge() string
+}
+
+// BearerToken returns an Authenticator accepting the given token in an "Authorization: Bearer" header,
+// or as the password of HTTP Basic credentials with any user, e.g. in a URL given to go tool pprof.
+// The principal is named "token".
+func BearerToken(token string) Authenticator {
+	return NamedTokens(map[string]string{"token": token})
+}
+
+// NamedTokens returns an Authenticator accepting any of the given tokens, keyed by name,
+// in an "Authorization: Bearer" header or as a Basic password. The principal is named after the token.
+func NamedTokens(tokens map[string]string) Authenticator {
+	tokens0 := make(map[string]string, len(tokens))
+	for name, token := range tokens {
+		tokens0[name] = token
+	}
+	return namedTokens(tokens0)
+}
+
+// namedTokens is the Authenticator returned by NamedTokens.
+type namedTokens map[string]string
+
+// Authenticate implements Authenticator.
+func (t namedTokens) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearer(r)
+	if !ok {
+		return nil, nil
+	}
+	names, tokens := make([]string, 0, len(t)), make([]string, 0, len(t))
+	for name, token0 := range t {
+		names, tokens = append(names, name), append(tokens, token0)
+	}
+	i := match(token, tokens)
+	if i < 0 {
+		return nil, ErrInvalidCredential
+	}
+	return &Principal{Name: names[i]}, nil
+}
+
+// BasicAuth returns an Authenticator accepting HTTP Basic credentials matching the given passwords,
+// keyed by user name. The principal is named after the user.
+func BasicAuth(users map[string]string) Authenticator {
+	users0 := make(map[string]string, len(users))
+	for user, password := range users {
+		users0[user] = password
+	}
+	return basicAuth(users0)
+}
+
+// basicAuth is the Authenticator returned by BasicAuth.
+type basicAuth map[string]string
+
+// Authenticate implements Authenticator.
+func (b basicAuth) Authenticate(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	password0, known := b[user]
+	// Compare even for unknown users, so that the time taken does not tell which users exist
+	if !equal(password, password0) || !known || password0 == "" {
+		return nil, ErrInvalidCredential
+	}
+	return &Principal{Name: user}, nil
+}
+
+// challenge implements challenger.
+func (b basicAuth) challenge() string {
+	return `Basic realm="pprof4svc", charset="UTF-8"`
+}
+
+// bearer returns the token of the "Authorization: Bearer" header of a request, or else the password
+// of its HTTP Basic credentials, which is how clients such as go tool pprof send a token given in a URL.
+func bearer(r *http.Request) (string, bool) {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, true
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// principalKey is the context key of the principal of an authenticated request.
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal of an authenticated request, from its context.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
@@ -20,32 +20,78 @@ import (
 	"math"
 	"net/http"
 	"runtime/debug"
-	"strings"
-
-	"github.com/gin-gonic/gin"
+	"time"
 )
 
+// GCStats is the JSON response of the GC statistics endpoint, with raw values and their units in the field names.
+// The recent pauses are listed most recent first, like in debug.GCStats.
+type GCStats struct {
+	SchemaVersion         int         `json:"schema_version"`            // Version of the schema, StatsSchemaVersion
+	SnapshotID            string      `json:"snapshot_id"`               // ID of the snapshot, for the "since" query parameter
+	Time                  time.Time   `json:"time"`                      // Time the statistics were read at
+	NumGC                 int64       `json:"num_gc"`                    // Number of garbage collections
+	PauseTotalNs          int64       `json:"pause_total_ns"`            // Total GC pause time
+	LastGC                *time.Time  `json:"last_gc,omitempty"`         // Time of the last garbage collection, if any
+	LastGCUnixNs          int64       `json:"last_gc_unix_ns"`           // Time of the last garbage collection, 0 if none
+	RecentPausesNs        []int64     `json:"recent_pauses_ns"`          // Recent GC pause durations
+	RecentPauseEnds       []time.Time `json:"recent_pause_ends"`         // Recent GC pause end times
+	RecentPauseEndsUnixNs []int64     `json:"recent_pause_ends_unix_ns"` // Recent GC pause end times
+}
+
+// newGCStats converts debug.GCStats into the JSON response of the GC statistics endpoint.
+func newGCStats(gs *debug.GCStats) GCStats {
+	stats := GCStats{
+		SchemaVersion:         StatsSchemaVersion,
+		Time:                  time.Now(),
+		NumGC:                 gs.NumGC,
+		PauseTotalNs:          gs.PauseTotal.Nanoseconds(),
+		RecentPausesNs:        make([]int64, len(gs.Pause)),
+		RecentPauseEnds:       make([]time.Time, len(gs.PauseEnd)),
+		RecentPauseEndsUnixNs: make([]int64, len(gs.PauseEnd)),
+	}
+	// ReadGCStats reports the Unix epoch, not the zero time, as the last GC before the first one
+	if gs.NumGC > 0 {
+		lastGC := gs.LastGC.UTC()
+		stats.LastGC, stats.LastGCUnixNs = &lastGC, lastGC.UnixNano()
+	}
+	for i, pause := range gs.Pause {
+		stats.RecentPausesNs[i] = pause.Nanoseconds()
+	}
+	for i, end := range gs.PauseEnd {
+		stats.RecentPauseEnds[i], stats.RecentPauseEndsUnixNs[i] = end.UTC(), end.UnixNano()
+	}
+	return stats
+}
+
 // gc0 handles HTTP requests to the GC statistics endpoint.
-// It reads debug.GCStats and returns either a formatted text response or JSON based on the "json" query parameter.
-func gc0(ctx *gin.Context) {
-	var gs debug.GCStats
-	// Read GC statistics from the runtime
-	debug.ReadGCStats(&gs)
-	// Check the "json" query parameter (case-insensitive)
-	json0 := strings.ToLower(ctx.Query("json"))
-	switch json0 {
-	default:
-		// Return formatted text output for GC stats by default
-		ctx.String(http.StatusOK, gcStats(&gs))
-	case "1", "t", "true":
-		// Return JSON output for GC stats if json=1, t, or true
-		ctx.JSON(http.StatusOK, gcStatsJSON(&gs))
+// It reads debug.GCStats and returns either a formatted text response or JSON based on the "json" query parameter,
+// or the delta with an earlier snapshot if the "delta" or "since" query parameter asks for it.
+func (p *plugin) gc0(w http.ResponseWriter, r *http.Request) {
+	if p.statsDelta(w, r, "gc", "GC") {
+		return
 	}
+	// Read GC statistics from the runtime, keeping them as a snapshot
+	snap := p.snapshots.take("gc")
+	gs := snap.stats.(*debug.GCStats)
+	w.Header().Set(snapshotHeader, snap.id)
+	// Return JSON output for GC stats if the "json" query parameter selects it, with formatted values if "pretty" does
+	if p.json(r) && pretty(r) {
+		writeJSON(w, http.StatusOK, gcStatsJSON(gs))
+		return
+	}
+	if p.json(r) {
+		stats := newGCStats(gs)
+		stats.Time, stats.SnapshotID = snap.time, snap.id
+		writeJSON(w, http.StatusOK, stats)
+		return
+	}
+	// Return formatted text output for GC stats by default
+	writeText(w, http.StatusOK, gcStats(gs, snap.id))
 }
 
 // gcStats formats debug.GCStats into a human-readable string.
 // It includes the number of GC runs, total pause time, last GC time, and recent pause details, with time in milliseconds.
-func gcStats(gs *debug.GCStats) string {
+func gcStats(gs *debug.GCStats, id string) string {
 	// Initialize output with a header
 	output := "=========================== Go Runtime GC Statistics ===========================\n"
 
@@ -54,8 +100,8 @@ func gcStats(gs *debug.GCStats) string {
 	// Convert total pause time from nanoseconds to milliseconds
 	output += fmt.Sprintf("PauseTotal:  %.2f ms (Total GC pause time)\n", float64(gs.PauseTotal.Nanoseconds())/1e6)
 
-	// Include last GC time if available, formatted as YYYY-MM-DD HH:MM:SS
-	if !gs.LastGC.IsZero() {
+	// Include last GC time if available, formatted as YYYY-MM-DD HH:MM:SS; before the first GC it is the Unix epoch
+	if gs.NumGC > 0 {
 		output += fmt.Sprintf("LastGC:      %s (Time of last garbage collection)\n", gs.LastGC.Format("2006-01-02 15:04:05"))
 	} else {
 		output += "LastGC:      Not available\n"
@@ -73,6 +119,8 @@ func gcStats(gs *debug.GCStats) string {
 		output += fmt.Sprintf("  Pause End %d: %s\n", i+1, end.Format("2006-01-02 15:04:05"))
 	}
 
+	output += fmt.Sprintf("Snapshot:    %s (Use ?since=%s to see what changed since)\n", id, id)
+
 	// Close output with a footer
 	output += "=========================== Go Runtime GC Statistics ===========================\n"
 	return output
@@ -93,9 +141,9 @@ func gcStatsJSON(gs *debug.GCStats) map[string]any {
 		recentPauseEnds[i] = end.Format("2006-01-02 15:04:05")
 	}
 
-	// Set last GC time, defaulting to "Not available" if zero
+	// Set last GC time, defaulting to "Not available" before the first GC, when it is the Unix epoch
 	lastGCTime := "Not available"
-	if !gs.LastGC.IsZero() {
+	if gs.NumGC > 0 {
 		lastGCTime = gs.LastGC.Format("2006-01-02 15:04:05")
 	}
 
@@ -0,0 +1,58 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the adapter registering the plugin with Gin.
+package pprof4svc
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Plug registers the plugin's routes with the provided Gin engine.
+// It sets up handlers for pprof, memory, GC, and trace endpoints; every prefixed route is guarded by auth.
+func (p *plugin) Plug(engine *gin.Engine) {
+	p.Mount(engine)
+}
+
+// Mount registers the plugin's routes with the provided Gin router, e.g. a *gin.RouterGroup.
+// The entrypoint and the prefixed routes inherit the router's base path and middleware,
+// and the given middleware runs in front of every route of the plugin, after the router's own.
+//
+// The stable pprof routes below the entrypoint are registered for the pprof package and the named profiles existing
+// when Mount is called, leaving any other path below the entrypoint to the app.
+// Besides them, a single dispatcher route is registered, with the prefix as a parameter, e.g.
+// "/:prefix/debug/*route", so that the prefix never shows up in Gin's route table or debug log, and rotating it
+// does not register any route. The dispatcher answers requests to unknown routes below it with Gin's 404.
+//
+// Gin panics when a route has a parameter where a sibling has a different one, so Mount panics if the router has a
+// route with a parameter as its first segment, e.g. "/:id/profile", unless WithPrefixParam gives the dispatcher
+// the same parameter name, e.g. "id". Otherwise, mount the plugin on a group such as "/internal", so that
+// the parameter of the dispatcher is scoped to the group.
+func (p *plugin) Mount(router gin.IRouter, middleware ...gin.HandlerFunc) {
+	group := router.Group("", middleware...)
+	base := strings.TrimSuffix(group.BasePath(), "/")
+	// handler hands the request over to the plugin, which does the routing and authentication itself
+	handler := func(ctx *gin.Context) {
+		p.serve(ctx.Writer, ctx.Request, base, strings.TrimPrefix(ctx.Request.URL.Path, base))
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost} {
+		group.Handle(method, p.entrypoint, handler)
+		// Register the stable pprof routes one by one, leaving the other paths below the entrypoint to the app
+		for _, name := range pprofNames() {
+			group.Handle(method, strings.TrimSuffix(p.entrypoint, "/")+"/"+name, handler)
+		}
+		group.Handle(method, "/:"+p.prefixParam+p.routes.root()+"*route", handler)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlugRootParam(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	newEngine := func() *gin.Engine {
+		engine := gin.New()
+		engine.GET("/:id/profile", func(ctx *gin.Context) { ctx.String(http.StatusOK, "profile of "+ctx.Param("id")) })
+		engine.POST("/:id", func(ctx *gin.Context) { ctx.String(http.StatusOK, "posted "+ctx.Param("id")) })
+		return engine
+	}
+
+	// Gin refuses the dispatcher next to a root parameter with another name
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("default parameter name: got no panic, want Gin's conflict")
+			}
+		}()
+		DefaultPlugin("token").Plug(newEngine())
+	}()
+
+	// With the app's parameter name, the app's routes keep working next to the dispatcher
+	engine := newEngine()
+	p, err := Plugin("token", WithPrefixParam("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Plug(engine)
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{http.MethodGet, "/42/profile", http.StatusOK, "profile of 42"},
+		{http.MethodPost, "/42", http.StatusOK, "posted 42"},
+		{http.MethodGet, p.prefixes()[0] + p.routes.Mem, http.StatusOK, ""},
+		{http.MethodGet, "/wrong" + p.routes.Mem, http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		r.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		if w.Code != test.status || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%s %s: got status %d and body %q, want %d and %q", test.method, test.path, w.Code, w.Body, test.status, test.body)
+		}
+	}
+}
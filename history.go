@@ -0,0 +1,289 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the background sampler of the memory and GC statistics, and the history endpoint serving them.
+package pprof4svc
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	historyTiers  = 3  // Number of resolutions the history is kept at
+	historyFactor = 10 // Number of samples of a tier aggregated into one of the next, coarser tier
+)
+
+// HistorySample is a sample of the memory and GC statistics kept by the history, as served by the history endpoint.
+// Samples older than the full resolution history aggregate several ones: their gauges are averaged, and their
+// counters and time are those of the last aggregated sample.
+type HistorySample struct {
+	Time           time.Time `json:"time"`             // Time the (last aggregated) statistics were read at
+	Samples        int       `json:"samples"`          // Number of samples aggregated, 1 at full resolution
+	HeapAllocBytes uint64    `json:"heap_alloc_bytes"` // Heap memory in use
+	HeapInuseBytes uint64    `json:"heap_inuse_bytes"` // Memory of the heap spans in use
+	HeapSysBytes   uint64    `json:"heap_sys_bytes"`   // Memory reserved for heap from OS
+	HeapObjects    uint64    `json:"heap_objects"`     // Number of allocated heap objects
+	NumGC          uint32    `json:"num_gc"`           // Number of garbage collections, cumulative
+	PauseTotalNs   uint64    `json:"pause_total_ns"`   // Total GC pause time, cumulative
+	Goroutines     int       `json:"goroutines"`       // Number of goroutines
+	GCCPUFraction  float64   `json:"gc_cpu_fraction"`  // Fraction of CPU used by GC, between 0 and 1
+	first          time.Time // Time the first aggregated statistics were read at
+}
+
+// history samples the memory and GC statistics in the background, keeping the most recent samples at full
+// resolution and older ones downsampled in coarser tiers, each holding as many samples.
+type history struct {
+	mu       sync.Mutex
+	interval time.Duration             // Interval between two samples
+	tiers    [historyTiers]historyTier // Tiers, from the finest to the coarsest
+	done     chan struct{}             // Closed to stop the sampler
+	once     sync.Once                 // Guards the closing of done
+}
+
+// historyTier is a ring buffer of the samples of a resolution.
+type historyTier struct {
+	samples []HistorySample // Ring buffer of the samples
+	next    int             // Index the next sample is written to
+	full    bool            // Whether the buffer wrapped around
+	pending historySum      // Samples of the finer tier waiting to be aggregated into one of this tier
+}
+
+// historySum sums samples to aggregate them, weighting each by the number of samples it already aggregates.
+type historySum struct {
+	parts   int           // Number of samples summed
+	samples int           // Number of samples aggregated by the summed ones
+	first   time.Time     // Time of the first sample aggregated by the summed ones
+	last    HistorySample // Last sample summed
+
+	// Sums of the gauges, weighted by the number of samples aggregated
+	heapAlloc, heapInuse, heapSys, heapObjects, goroutines, gcCPU float64
+}
+
+// add adds a sample to the sum.
+func (s *historySum) add(x HistorySample) {
+	w := float64(x.Samples)
+	s.heapAlloc += w * float64(x.HeapAllocBytes)
+	s.heapInuse += w * float64(x.HeapInuseBytes)
+	s.heapSys += w * float64(x.HeapSysBytes)
+	s.heapObjects += w * float64(x.HeapObjects)
+	s.goroutines += w * float64(x.Goroutines)
+	s.gcCPU += w * x.GCCPUFraction
+	if s.parts == 0 {
+		s.first = x.first
+	}
+	s.parts, s.samples, s.last = s.parts+1, s.samples+x.Samples, x
+}
+
+// sample returns the aggregate of the summed samples.
+func (s *historySum) sample() HistorySample {
+	x, n := s.last, float64(s.samples)
+	x.Samples, x.first = s.samples, s.first
+	x.HeapAllocBytes, x.HeapInuseBytes = uint64(s.heapAlloc/n), uint64(s.heapInuse/n)
+	x.HeapSysBytes, x.HeapObjects = uint64(s.heapSys/n), uint64(s.heapObjects/n)
+	x.Goroutines, x.GCCPUFraction = int(s.goroutines/n), s.gcCPU/n
+	return x
+}
+
+// newHistory returns a history sampling every interval and keeping size samples per tier.
+func newHistory(interval time.Duration, size int) *history {
+	h := &history{interval: interval, done: make(chan struct{})}
+	for i := range h.tiers {
+		h.tiers[i].samples = make([]HistorySample, size)
+	}
+	return h
+}
+
+// start samples the statistics now and then every interval in the background, until stop is called.
+func (h *history) start() {
+	ticker := time.NewTicker(h.interval)
+	h.sample()
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.sample()
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the sampler; the samples taken so far are kept.
+func (h *history) stop() {
+	h.once.Do(func() { close(h.done) })
+}
+
+// sample reads the statistics and adds them to the history.
+func (h *history) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	h.add(HistorySample{
+		Time:           time.Now(),
+		Samples:        1,
+		HeapAllocBytes: ms.HeapAlloc,
+		HeapInuseBytes: ms.HeapInuse,
+		HeapSysBytes:   ms.HeapSys,
+		HeapObjects:    ms.HeapObjects,
+		NumGC:          ms.NumGC,
+		PauseTotalNs:   ms.PauseTotalNs,
+		Goroutines:     runtime.NumGoroutine(),
+		GCCPUFraction:  ms.GCCPUFraction,
+	})
+}
+
+// add adds a sample to the finest tier, and every historyFactor samples of a tier an aggregate of them to the next.
+func (h *history) add(x HistorySample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	x.first = x.Time
+	for i := range h.tiers {
+		t := &h.tiers[i]
+		if i > 0 {
+			if t.pending.add(x); t.pending.parts < historyFactor {
+				return
+			}
+			x, t.pending = t.pending.sample(), historySum{}
+		}
+		t.samples[t.next] = x
+		t.next = (t.next + 1) % len(t.samples)
+		t.full = t.full || t.next == 0
+	}
+}
+
+// query returns the samples taken in [from, to], oldest first, at the finest resolution still kept for each time.
+// A coarser sample aggregating samples from before and after the oldest sample of the finer tiers replaces the finer
+// samples it aggregates, so that the samples cover the history without gaps or overlaps. The samples still being
+// aggregated count as the newest sample of the coarser tier, since the finer tier may no longer hold all of them.
+func (h *history) query(from, to time.Time) []HistorySample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var all []HistorySample
+	var oldest time.Time // Time of the first sample aggregated by the finer tiers; coarser ones only cover what precedes it
+	for i := range h.tiers {
+		t := &h.tiers[i]
+		samples := t.list()
+		for _, x := range samples {
+			if !oldest.IsZero() && !x.first.Before(oldest) {
+				break
+			}
+			if !oldest.IsZero() && !x.Time.Before(oldest) {
+				// x also aggregates samples of the finer tiers, which it replaces
+				kept := all[:0]
+				for _, y := range all {
+					if y.first.Before(oldest) || y.first.After(x.Time) {
+						kept = append(kept, y)
+					}
+				}
+				all = kept
+			}
+			all = append(all, x)
+		}
+		if len(samples) > 0 && (oldest.IsZero() || samples[0].first.Before(oldest)) {
+			oldest = samples[0].first
+		}
+	}
+	result := []HistorySample{}
+	for _, x := range all {
+		if !x.Time.Before(from) && !x.Time.After(to) {
+			result = append(result, x)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result
+}
+
+// list returns the samples of the tier, oldest first, followed by the aggregate of the pending samples if any.
+func (t *historyTier) list() []HistorySample {
+	n, first := t.next, 0
+	if t.full {
+		n, first = len(t.samples), t.next
+	}
+	samples := make([]HistorySample, 0, n+1)
+	for j := 0; j < n; j++ {
+		samples = append(samples, t.samples[(first+j)%len(t.samples)])
+	}
+	if t.pending.parts > 0 {
+		samples = append(samples, t.pending.sample())
+	}
+	return samples
+}
+
+// history0 handles HTTP requests to the history endpoint. It serves the samples taken between the "from" and "to"
+// query parameters, each a time in RFC 3339 format or a duration before now, as CSV, or as JSON if the "json" or
+// "format" query parameter selects it.
+func (p *plugin) history0(w http.ResponseWriter, r *http.Request) {
+	if p.history == nil {
+		serveError(w, http.StatusNotFound, "History is not enabled")
+		return
+	}
+	now := time.Now()
+	from, err := historyTime(r.URL.Query().Get("from"), now, time.Time{})
+	if err != nil {
+		serveError(w, http.StatusBadRequest, "Invalid from: "+err.Error())
+		return
+	}
+	to, err := historyTime(r.URL.Query().Get("to"), now, now)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, "Invalid to: "+err.Error())
+		return
+	}
+	samples := p.history.query(from, to)
+	if p.json(r) || r.URL.Query().Get("format") == "json" {
+		writeJSON(w, http.StatusOK, samples)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	c := csv.NewWriter(w)
+	c.Write([]string{"time", "samples", "heap_alloc_bytes", "heap_inuse_bytes", "heap_sys_bytes", "heap_objects",
+		"num_gc", "pause_total_ns", "goroutines", "gc_cpu_fraction"})
+	for _, x := range samples {
+		c.Write([]string{
+			x.Time.Format(time.RFC3339Nano),
+			strconv.Itoa(x.Samples),
+			strconv.FormatUint(x.HeapAllocBytes, 10),
+			strconv.FormatUint(x.HeapInuseBytes, 10),
+			strconv.FormatUint(x.HeapSysBytes, 10),
+			strconv.FormatUint(x.HeapObjects, 10),
+			strconv.FormatUint(uint64(x.NumGC), 10),
+			strconv.FormatUint(x.PauseTotalNs, 10),
+			strconv.Itoa(x.Goroutines),
+			strconv.FormatFloat(x.GCCPUFraction, 'g', -1, 64),
+		})
+	}
+	c.Flush()
+}
+
+// historyTime parses a bound of the time range of the history endpoint: a time in RFC 3339 format, or a duration
+// before now, e.g. "15m". It returns def for an empty value.
+func historyTime(value string, now, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+	return now.Add(-d), nil
+}
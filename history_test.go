@@ -0,0 +1,110 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"testing"
+	"time"
+)
+
+// historyStart is the time of the first sample added by fillHistory.
+var historyStart = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fillHistory adds n samples to a history, one per second, the k-th with k as its gauges and counters.
+func fillHistory(h *history, n int) {
+	for k := 0; k < n; k++ {
+		h.add(HistorySample{
+			Time:           historyStart.Add(time.Duration(k) * time.Second),
+			Samples:        1,
+			HeapAllocBytes: uint64(k),
+			NumGC:          uint32(k),
+			Goroutines:     k,
+		})
+	}
+}
+
+// historyIndex returns the index of the sample added by fillHistory at t.
+func historyIndex(t time.Time) int {
+	return int(t.Sub(historyStart) / time.Second)
+}
+
+func TestHistoryDownsampling(t *testing.T) {
+	h := newHistory(time.Second, 10)
+	fillHistory(h, 1000)
+	for i, tier := range h.tiers {
+		span := 1
+		for j := 0; j < i; j++ {
+			span *= historyFactor
+		}
+		for _, x := range tier.list() {
+			last := historyIndex(x.Time)
+			first := last - span + 1
+			if x.Samples != span || historyIndex(x.first) != first {
+				t.Errorf("tier %d, sample at %d: got %d samples from %d, want %d from %d", i, last, x.Samples, historyIndex(x.first), span, first)
+			}
+			// Gauges are averaged, counters are those of the last sample
+			if want := uint64(first+last) / 2; x.HeapAllocBytes != want || x.Goroutines != int(want) {
+				t.Errorf("tier %d, sample at %d: got gauges %d and %d, want %d", i, last, x.HeapAllocBytes, x.Goroutines, want)
+			}
+			if x.NumGC != uint32(last) {
+				t.Errorf("tier %d, sample at %d: got counter %d, want %d", i, last, x.NumGC, last)
+			}
+		}
+	}
+	if n := len(h.tiers[2].list()); n != 10 {
+		t.Errorf("coarsest tier: got %d samples, want 10", n)
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	tests := []struct {
+		size, n int
+	}{
+		{3, 250}, {3, 7}, {10, 250}, {10, 255}, {25, 1234}, {360, 5000}, {1, 1001},
+	}
+	for _, test := range tests {
+		h := newHistory(time.Second, test.size)
+		fillHistory(h, test.n)
+		samples := h.query(time.Time{}, historyStart.Add(time.Duration(test.n)*time.Second))
+		if len(samples) == 0 || historyIndex(samples[len(samples)-1].Time) != test.n-1 {
+			t.Errorf("size %d, %d samples: got %v, want samples up to the last one", test.size, test.n, samples)
+			continue
+		}
+		// The samples cover the history up to the last one without gaps or overlaps, and the most recent ones
+		// are at full resolution
+		for i := 1; i < len(samples); i++ {
+			if prev, x := historyIndex(samples[i-1].Time), historyIndex(samples[i].first); x != prev+1 {
+				t.Errorf("size %d, %d samples: got a sample from %d after one up to %d", test.size, test.n, x, prev)
+			}
+		}
+		if last := samples[len(samples)-1]; test.size >= historyFactor && last.Samples != 1 {
+			t.Errorf("size %d, %d samples: got %d samples aggregated by the last one, want 1", test.size, test.n, last.Samples)
+		}
+	}
+
+	// Only the samples taken in the range are returned; the aggregate of 100 to 199 replaces those of 150 to 199
+	h := newHistory(time.Second, 10)
+	fillHistory(h, 250)
+	from, to := historyStart.Add(100*time.Second), historyStart.Add(245*time.Second)
+	samples := h.query(from, to)
+	if len(samples) == 0 {
+		t.Fatal("range: got no samples")
+	}
+	for _, x := range samples {
+		if x.Time.Before(from) || x.Time.After(to) {
+			t.Errorf("range: got a sample at %d, want one in [100, 245]", historyIndex(x.Time))
+		}
+	}
+	if first, last := historyIndex(samples[0].Time), historyIndex(samples[len(samples)-1].Time); first != 199 || last != 245 {
+		t.Errorf("range: got samples at %d to %d, want 199 to 245", first, last)
+	}
+}
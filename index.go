@@ -0,0 +1,151 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the pprof index, which lists only the enabled endpoints.
+package pprof4svc
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"runtime/pprof"
+	"sort"
+	"strings"
+)
+
+// profileDescriptions holds the descriptions shown on the pprof index, as in net/http/pprof.
+var profileDescriptions = map[string]string{
+	"allocs":       "A sampling of all past memory allocations",
+	"block":        "Stack traces that led to blocking on synchronization primitives",
+	"cmdline":      "The command line invocation of the current program",
+	"goroutine":    "Stack traces of all current goroutines. Use debug=2 as a query parameter to export in the same format as an unrecovered panic.",
+	"heap":         "A sampling of memory allocations of live objects. You can specify the gc GET parameter to run GC before taking the heap sample.",
+	"mutex":        "Stack traces of holders of contended mutexes",
+	"profile":      "CPU profile. You can specify the duration in the seconds GET parameter. After you get the profile file, use the go tool pprof command to investigate the profile.",
+	"symbol":       "Maps given program counters to function names. Counters can be specified in a GET raw query or POST body, multiple counters are separated by '+'.",
+	"threadcreate": "Stack traces that led to the creation of new OS threads",
+	"trace":        "A trace of execution of the current program. You can specify the duration in the seconds GET parameter. After you get the trace file, use the go tool trace command to investigate the trace.",
+}
+
+// pprofNames returns the names of the routes below the pprof index: those of the pprof package and of the named
+// profiles that currently exist.
+func pprofNames() []string {
+	names := []string{"cmdline", "profile", "symbol", "trace"}
+	for _, prof := range pprof.Profiles() {
+		names = append(names, prof.Name())
+	}
+	return names
+}
+
+// pprofName reports whether name is the name of a route below the pprof index.
+func pprofName(name string) bool {
+	switch name {
+	case "cmdline", "profile", "symbol", "trace":
+		return true
+	}
+	return pprof.Lookup(name) != nil
+}
+
+// profileEntry is a row of the pprof index.
+type profileEntry struct {
+	Name  string // Name of the profile, also its route relative to the index
+	Desc  string // Description of the profile
+	Count int    // Number of samples, for named profiles
+}
+
+// index serves the pprof index like pprof.Index does, but lists only the endpoints that are enabled and
+// allowed to the principal, so that it never links to a route that answers 404 or 403,
+// and links the statistics endpoints too.
+func (p *plugin) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Collect the named profiles and the endpoints of the pprof package that are enabled
+	var profiles []profileEntry
+	if p.endpoints[EndpointProfiles] && allowed(r, EndpointProfiles) {
+		for _, prof := range pprof.Profiles() {
+			profiles = append(profiles, profileEntry{Name: prof.Name(), Desc: profileDescriptions[prof.Name()], Count: prof.Count()})
+		}
+	}
+	for endpoint, name := range map[Endpoint]string{
+		EndpointCmdline:    "cmdline",
+		EndpointProfile:    "profile",
+		EndpointSymbol:     "symbol",
+		EndpointPprofTrace: "trace",
+	} {
+		if p.endpoints[endpoint] && allowed(r, endpoint) {
+			profiles = append(profiles, profileEntry{Name: name, Desc: profileDescriptions[name]})
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	// Render the page with the same layout as pprof.Index
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<html>
+<head>
+<title>%s</title>
+<style>
+.profile-name{
+	display:inline-block;
+	width:6rem;
+}
+</style>
+</head>
+<body>
+%s
+<br>
+<p>Set debug=1 as a query parameter to export in legacy text format</p>
+<br>
+Types of profiles available:
+<table>
+<thead><td>Count</td><td>Profile</td></thead>
+`, html.EscapeString(p.routes.Pprof), html.EscapeString(p.routes.Pprof))
+	for _, profile := range profiles {
+		link := &url.URL{Path: profile.Name, RawQuery: "debug=1"}
+		fmt.Fprintf(&b, "<tr><td>%d</td><td><a href='%s'>%s</a></td></tr>\n", profile.Count, link, html.EscapeString(profile.Name))
+	}
+	b.WriteString("</table>\n")
+	if p.endpoints[EndpointProfiles] && allowed(r, EndpointProfiles) {
+		b.WriteString("<a href=\"goroutine?debug=2\">full goroutine stack dump</a>\n<br>\n")
+	}
+	// Link the enabled statistics and trace endpoints, relative to the index
+	up := strings.Repeat("../", strings.Count(p.routes.Pprof, "/")-1)
+	for _, stat := range []struct {
+		endpoint    Endpoint
+		route, desc string
+	}{
+		{EndpointMem, p.routes.Mem, "Memory statistics"},
+		{EndpointGC, p.routes.GC, "GC statistics"},
+		{EndpointTrace, p.routes.Trace, "Runtime trace capture"},
+		{EndpointMetrics, p.routes.Metrics, "Prometheus metrics"},
+		{EndpointRuntimeMetrics, p.routes.RuntimeMetrics, "Runtime metrics"},
+		{EndpointHistory, p.routes.History, "Memory and GC history"},
+		{EndpointAudit, p.routes.Audit, "Recent audit events"},
+	} {
+		if stat.endpoint == EndpointHistory && p.history == nil {
+			continue
+		}
+		if p.endpoints[stat.endpoint] && allowed(r, stat.endpoint) {
+			link := &url.URL{Path: up + strings.TrimPrefix(stat.route, "/")}
+			fmt.Fprintf(&b, "<a href='%s'>%s</a>\n<br>\n", link, html.EscapeString(stat.desc))
+		}
+	}
+	fmt.Fprintf(&b, "<a href='%s'>Log out</a>\n<br>\n", &url.URL{Path: up + strings.TrimPrefix(p.routes.Logout, "/")})
+	b.WriteString("<p>\nProfile Descriptions:\n<ul>\n")
+	for _, profile := range profiles {
+		fmt.Fprintf(&b, "<li><div class=profile-name>%s: </div> %s</li>\n", html.EscapeString(profile.Name), html.EscapeString(profile.Desc))
+	}
+	b.WriteString("</ul>\n</p>\n</body>\n</html>")
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,192 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the rate and concurrency limits, and the lockout of clients failing to authenticate.
+package pprof4svc
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit limits the requests to the entrypoint or to an endpoint; requests above it get 429.
+type Limit struct {
+	Concurrency int     // Requests served at once; unlimited if zero
+	Rate        float64 // Requests per second; unlimited if zero
+	Burst       int     // Requests allowed at once above the rate, 1 if zero
+}
+
+// limiter enforces a Limit, with a token bucket for the rate. A nil limiter admits every request.
+type limiter struct {
+	limit  Limit
+	mu     sync.Mutex
+	tokens float64   // Requests the bucket admits
+	last   time.Time // Time the bucket was last refilled
+	active int       // Requests being served
+}
+
+// newLimiter returns a limiter enforcing the limit, or nil if it is zero.
+func newLimiter(limit Limit) *limiter {
+	if limit == (Limit{}) {
+		return nil
+	}
+	if limit.Burst == 0 {
+		limit.Burst = 1
+	}
+	return &limiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// acquire admits a request, which must be released when served, or returns the time to retry after.
+func (l *limiter) acquire() (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit.Concurrency > 0 && l.active >= l.limit.Concurrency {
+		return time.Second, false
+	}
+	if l.limit.Rate > 0 {
+		now := time.Now()
+		l.tokens = math.Min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+		l.last = now
+		if l.tokens < 1 {
+			return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second)), false
+		}
+		l.tokens--
+	}
+	l.active++
+	return 0, true
+}
+
+// release releases a request admitted by acquire.
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+}
+
+// admit admits a request with the limiter, answering 429 if it is refused.
+func admit(w http.ResponseWriter, l *limiter) bool {
+	retry, ok := l.acquire()
+	if !ok {
+		tooManyRequests(w, retry)
+	}
+	return ok
+}
+
+// tooManyRequests answers 429, telling the client when to retry.
+func tooManyRequests(w http.ResponseWriter, retry time.Duration) {
+	retryAfter(w, retry)
+	serveError(w, http.StatusTooManyRequests, "Too many requests")
+}
+
+// retryAfter sets the Retry-After header of a response, in whole seconds.
+func retryAfter(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+}
+
+// lockout counts the failed authentications of each client, and locks a client out once it reaches
+// the threshold, for a time doubling with every further failure. A nil lockout never locks out.
+type lockout struct {
+	threshold int           // Failures locking a client out
+	base      time.Duration // Time the first lockout lasts
+	max       time.Duration // Longest lockout, after which quiet clients are forgotten
+	mu        sync.Mutex
+	clients   map[string]*failures
+}
+
+// failures are the failed authentications of a client.
+type failures struct {
+	count int       // Consecutive failures
+	last  time.Time // Time of the last failure
+	until time.Time // Time the client is locked out until
+}
+
+// locked returns the time a client is still locked out for, if it is.
+func (l *lockout) locked(client string) (time.Duration, bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.clients[client]; ok {
+		if wait := time.Until(f.until); wait > 0 {
+			return wait, true
+		}
+	}
+	return 0, false
+}
+
+// fail counts a failed authentication of a client, and forgets the clients that have been quiet for long.
+func (l *lockout) fail(client string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.clients == nil {
+		l.clients = map[string]*failures{}
+	}
+	for client0, f := range l.clients {
+		if now.Sub(f.last) > l.max && now.After(f.until) {
+			delete(l.clients, client0)
+		}
+	}
+	f, ok := l.clients[client]
+	if !ok {
+		f = &failures{}
+		l.clients[client] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= l.threshold {
+		wait := l.base
+		for i := l.threshold; i < f.count && wait < l.max; i++ {
+			wait *= 2
+		}
+		if wait > l.max {
+			wait = l.max
+		}
+		f.until = now.Add(wait)
+	}
+}
+
+// succeed forgets the failures of a client that authenticated.
+func (l *lockout) succeed(client string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.clients, client)
+	l.mu.Unlock()
+}
+
+// client returns the key identifying the client of a request for the lockout: its address, from behind
+// the trusted proxies, or else the host of the remote address, without the port that changes with every connection.
+func (p *plugin) client(r *http.Request) string {
+	if addr, ok := p.clientAddr(r); ok {
+		return addr.String()
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
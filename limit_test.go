@@ -0,0 +1,175 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockoutBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		failures  int
+		want      time.Duration // Time the client is locked out for, none if zero
+	}{
+		{"below the threshold", 3, 2, 0},
+		{"at the threshold", 3, 3, time.Second},
+		{"one failure more", 3, 4, 2 * time.Second},
+		{"two failures more", 3, 5, 4 * time.Second},
+		{"capped", 3, 10, 30 * time.Second},
+		{"far beyond the cap", 3, 1000, 30 * time.Second},
+		{"threshold of one", 1, 1, time.Second},
+	}
+	for _, test := range tests {
+		l := &lockout{threshold: test.threshold, base: time.Second, max: 30 * time.Second}
+		for i := 0; i < test.failures; i++ {
+			l.fail("192.0.2.1")
+		}
+		wait, locked := l.locked("192.0.2.1")
+		if locked != (test.want > 0) || wait > test.want || wait < test.want-time.Second {
+			t.Errorf("%s: got locked %v for %s, want %s", test.name, locked, wait, test.want)
+		}
+		if _, locked := l.locked("192.0.2.2"); locked {
+			t.Errorf("%s: got another client locked out", test.name)
+		}
+		l.succeed("192.0.2.1")
+		if _, locked := l.locked("192.0.2.1"); locked {
+			t.Errorf("%s: got the client locked out after a success", test.name)
+		}
+	}
+
+	var l *lockout
+	l.fail("192.0.2.1")
+	if _, locked := l.locked("192.0.2.1"); locked {
+		t.Error("nil lockout: got the client locked out")
+	}
+}
+
+func TestLockoutPruning(t *testing.T) {
+	l := &lockout{threshold: 2, base: time.Second, max: time.Minute}
+	now := time.Now()
+	l.clients = map[string]*failures{
+		"quiet":           {count: 1, last: now.Add(-2 * time.Minute)},
+		"quiet but still": {count: 9, last: now.Add(-2 * time.Minute), until: now.Add(time.Minute)},
+		"recent":          {count: 1, last: now.Add(-time.Second)},
+	}
+	l.fail("new")
+	for client, want := range map[string]bool{"quiet": false, "quiet but still": true, "recent": true, "new": true} {
+		if _, ok := l.clients[client]; ok != want {
+			t.Errorf("client %q: got kept %v, want %v", client, ok, want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if newLimiter(Limit{}) != nil {
+		t.Error("zero limit: got a limiter, want none")
+	}
+	var none *limiter
+	if _, ok := none.acquire(); !ok {
+		t.Error("nil limiter: got a refusal")
+	}
+
+	// Concurrency
+	l := newLimiter(Limit{Concurrency: 2})
+	for i := 0; i < 2; i++ {
+		if _, ok := l.acquire(); !ok {
+			t.Fatalf("concurrent request %d: got a refusal", i)
+		}
+	}
+	if retry, ok := l.acquire(); ok || retry != time.Second {
+		t.Errorf("third concurrent request: got %v after %s, want a refusal after 1s", ok, retry)
+	}
+	l.release()
+	if _, ok := l.acquire(); !ok {
+		t.Error("request after a release: got a refusal")
+	}
+
+	// Token bucket: the burst, then the rate
+	l = newLimiter(Limit{Rate: 2, Burst: 3})
+	for i := 0; i < 3; i++ {
+		if _, ok := l.acquire(); !ok {
+			t.Fatalf("request %d of the burst: got a refusal", i)
+		}
+		l.release()
+	}
+	retry, ok := l.acquire()
+	if ok || retry <= 0 || retry > 500*time.Millisecond {
+		t.Errorf("request above the burst: got %v after %s, want a refusal after at most 500ms", ok, retry)
+	}
+	tests := []struct {
+		name    string
+		elapsed time.Duration // Time since the last refill
+		want    int           // Requests admitted after it
+	}{
+		{"half a token", 250 * time.Millisecond, 0},
+		{"one token", 500 * time.Millisecond, 1},
+		{"two tokens", time.Second, 2},
+		{"refill capped at the burst", time.Hour, 3},
+	}
+	for _, test := range tests {
+		l.mu.Lock()
+		l.tokens, l.last = 0, time.Now().Add(-test.elapsed)
+		l.mu.Unlock()
+		got := 0
+		for ; got < 10; got++ {
+			if _, ok := l.acquire(); !ok {
+				break
+			}
+			l.release()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %d requests admitted, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		retry time.Duration
+		want  string
+	}{
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Millisecond, "1"},
+		{15 * time.Minute, "900"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		tooManyRequests(w, test.retry)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != test.want {
+			t.Errorf("retry after %s: got status %d and Retry-After %q, want %d and %q", test.retry, w.Code,
+				w.Header().Get("Retry-After"), http.StatusTooManyRequests, test.want)
+		}
+	}
+
+	// A client locked out gets 429 with the time left, even with the right credential
+	p, err := Plugin("token", WithLockout(1, time.Minute, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := p.prefixes()[0]
+	for _, token := range []string{"wrong", "token"} {
+		r := httptest.NewRequest(http.MethodGet, prefix+p.routes.Mem, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if token == "token" && (w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60") {
+			t.Errorf("locked out client: got status %d and Retry-After %q, want %d and %q", w.Code,
+				w.Header().Get("Retry-After"), http.StatusTooManyRequests, "60")
+		}
+	}
+}
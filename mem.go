@@ -18,33 +18,109 @@ import (
 	"math"
 	"net/http"
 	"runtime"
-	"strings"
 	"time"
-
-	"github.com/gin-gonic/gin"
 )
 
+// MemStats is the JSON response of the memory statistics endpoint, with raw values and their units in the field names.
+type MemStats struct {
+	SchemaVersion     int        `json:"schema_version"`      // Version of the schema, StatsSchemaVersion
+	SnapshotID        string     `json:"snapshot_id"`         // ID of the snapshot, for the "since" query parameter
+	Time              time.Time  `json:"time"`                // Time the statistics were read at
+	HeapAllocBytes    uint64     `json:"heap_alloc_bytes"`    // Current heap memory in use
+	TotalAllocBytes   uint64     `json:"total_alloc_bytes"`   // Cumulative total memory allocated on heap
+	SysBytes          uint64     `json:"sys_bytes"`           // Total memory obtained from OS
+	HeapSysBytes      uint64     `json:"heap_sys_bytes"`      // Memory reserved for heap from OS
+	HeapIdleBytes     uint64     `json:"heap_idle_bytes"`     // Heap memory reserved but not in use
+	HeapInuseBytes    uint64     `json:"heap_inuse_bytes"`    // Heap memory currently in use
+	HeapReleasedBytes uint64     `json:"heap_released_bytes"` // Heap memory returned to OS
+	HeapObjects       uint64     `json:"heap_objects"`        // Number of allocated heap objects
+	Mallocs           uint64     `json:"mallocs"`             // Total number of mallocs
+	Frees             uint64     `json:"frees"`               // Total number of frees
+	NumGC             uint32     `json:"num_gc"`              // Number of garbage collections
+	NumForcedGC       uint32     `json:"num_forced_gc"`       // Number of garbage collections forced by the application
+	PauseTotalNs      uint64     `json:"pause_total_ns"`      // Total GC pause time
+	GCCPUFraction     float64    `json:"gc_cpu_fraction"`     // Fraction of CPU used by GC, between 0 and 1
+	NextGCBytes       uint64     `json:"next_gc_bytes"`       // Target heap size of the next GC
+	LastGC            *time.Time `json:"last_gc,omitempty"`   // Time of the last garbage collection, if any
+	LastGCUnixNs      int64      `json:"last_gc_unix_ns"`     // Time of the last garbage collection, 0 if none
+	StackInuseBytes   uint64     `json:"stack_inuse_bytes"`   // Memory used by stack
+	StackSysBytes     uint64     `json:"stack_sys_bytes"`     // Memory reserved for stack from OS
+	MCacheInuseBytes  uint64     `json:"mcache_inuse_bytes"`  // Memory used by mcache
+	MCacheSysBytes    uint64     `json:"mcache_sys_bytes"`    // Memory reserved for mcache from OS
+	MSpanInuseBytes   uint64     `json:"mspan_inuse_bytes"`   // Memory used by mspan
+	MSpanSysBytes     uint64     `json:"mspan_sys_bytes"`     // Memory reserved for mspan from OS
+	GCSysBytes        uint64     `json:"gc_sys_bytes"`        // Memory used by GC metadata
+	BuckHashSysBytes  uint64     `json:"buck_hash_sys_bytes"` // Memory used by the profiling bucket hash table
+	OtherSysBytes     uint64     `json:"other_sys_bytes"`     // Other system memory
+}
+
+// newMemStats converts runtime.MemStats into the JSON response of the memory statistics endpoint.
+func newMemStats(ms *runtime.MemStats) MemStats {
+	stats := MemStats{
+		SchemaVersion:     StatsSchemaVersion,
+		Time:              time.Now(),
+		HeapAllocBytes:    ms.HeapAlloc,
+		TotalAllocBytes:   ms.TotalAlloc,
+		SysBytes:          ms.Sys,
+		HeapSysBytes:      ms.HeapSys,
+		HeapIdleBytes:     ms.HeapIdle,
+		HeapInuseBytes:    ms.HeapInuse,
+		HeapReleasedBytes: ms.HeapReleased,
+		HeapObjects:       ms.HeapObjects,
+		Mallocs:           ms.Mallocs,
+		Frees:             ms.Frees,
+		NumGC:             ms.NumGC,
+		NumForcedGC:       ms.NumForcedGC,
+		PauseTotalNs:      ms.PauseTotalNs,
+		GCCPUFraction:     ms.GCCPUFraction,
+		NextGCBytes:       ms.NextGC,
+		LastGCUnixNs:      int64(ms.LastGC),
+		StackInuseBytes:   ms.StackInuse,
+		StackSysBytes:     ms.StackSys,
+		MCacheInuseBytes:  ms.MCacheInuse,
+		MCacheSysBytes:    ms.MCacheSys,
+		MSpanInuseBytes:   ms.MSpanInuse,
+		MSpanSysBytes:     ms.MSpanSys,
+		GCSysBytes:        ms.GCSys,
+		BuckHashSysBytes:  ms.BuckHashSys,
+		OtherSysBytes:     ms.OtherSys,
+	}
+	if ms.LastGC > 0 {
+		lastGC := time.Unix(0, int64(ms.LastGC)).UTC()
+		stats.LastGC = &lastGC
+	}
+	return stats
+}
+
 // mem0 handles HTTP requests to the memory statistics endpoint.
-// It reads runtime.MemStats and returns either a formatted text response or JSON based on the "json" query parameter.
-func mem0(ctx *gin.Context) {
-	var ms runtime.MemStats
-	// Read memory statistics from the runtime
-	runtime.ReadMemStats(&ms)
-	// Check the "json" query parameter (case-insensitive)
-	json0 := strings.ToLower(ctx.Query("json"))
-	switch json0 {
-	default:
-		// Return formatted text output for memory stats by default
-		ctx.String(http.StatusOK, memStats(&ms))
-	case "1", "t", "true":
-		// Return JSON output for memory stats if json=1, t, or true
-		ctx.JSON(http.StatusOK, memStatsJSON(&ms))
+// It reads runtime.MemStats and returns either a formatted text response or JSON based on the "json" query parameter,
+// or the delta with an earlier snapshot if the "delta" or "since" query parameter asks for it.
+func (p *plugin) mem0(w http.ResponseWriter, r *http.Request) {
+	if p.statsDelta(w, r, "mem", "Memory") {
+		return
+	}
+	// Read memory statistics from the runtime, keeping them as a snapshot
+	snap := p.snapshots.take("mem")
+	ms := snap.stats.(*runtime.MemStats)
+	w.Header().Set(snapshotHeader, snap.id)
+	// Return JSON output for memory stats if the "json" query parameter selects it, with formatted values if "pretty" does
+	if p.json(r) && pretty(r) {
+		writeJSON(w, http.StatusOK, memStatsJSON(ms))
+		return
+	}
+	if p.json(r) {
+		stats := newMemStats(ms)
+		stats.Time, stats.SnapshotID = snap.time, snap.id
+		writeJSON(w, http.StatusOK, stats)
+		return
 	}
+	// Return formatted text output for memory stats by default
+	writeText(w, http.StatusOK, memStats(ms, snap.id))
 }
 
 // memStats formats runtime.MemStats into a human-readable string.
 // It includes memory allocation, GC, and system memory stats, with memory sizes in human-readable units and time in milliseconds.
-func memStats(ms *runtime.MemStats) string {
+func memStats(ms *runtime.MemStats, id string) string {
 	// Initialize output with a header
 	output := "=========================== Go Runtime Memory Statistics ===========================\n"
 
@@ -85,6 +161,7 @@ func memStats(ms *runtime.MemStats) string {
 	output += fmt.Sprintf("MSpanInuse:  %s (Memory used by mspan)\n", convertBytes(ms.MSpanInuse))
 	output += fmt.Sprintf("MSpanSys:    %s (Memory reserved for mspan from OS)\n", convertBytes(ms.MSpanSys))
 	output += fmt.Sprintf("OtherSys:    %s (Other system memory)\n", convertBytes(ms.OtherSys))
+	output += fmt.Sprintf("Snapshot:    %s (Use ?since=%s to see what changed since)\n", id, id)
 
 	// Close output with a footer
 	output += "=========================== Go Runtime Memory Statistics ==========================="
@@ -0,0 +1,183 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the metrics endpoint, exposing the runtime statistics to Prometheus.
+package pprof4svc
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types of the metrics endpoint.
+const (
+	prometheusType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// metrics0 handles HTTP requests to the metrics endpoint. It exposes runtime.MemStats, debug.GCStats with the
+// distribution of the GC pauses, the number of goroutines and threads, and the build info, in the Prometheus text
+// format, or in the OpenMetrics one if the Accept header or "format=openmetrics" asks for it.
+func (p *plugin) metrics0(w http.ResponseWriter, r *http.Request) {
+	openMetrics := r.URL.Query().Get("format") == "openmetrics" ||
+		strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	m := &metricsWriter{openMetrics: openMetrics}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	for _, g := range []struct {
+		name, help string
+		value      uint64
+	}{
+		{"go_memstats_alloc_bytes", "Bytes of allocated heap objects.", ms.Alloc},
+		{"go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", ms.Sys},
+		{"go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", ms.HeapAlloc},
+		{"go_memstats_heap_sys_bytes", "Bytes of heap memory obtained from the OS.", ms.HeapSys},
+		{"go_memstats_heap_idle_bytes", "Bytes in idle (unused) spans.", ms.HeapIdle},
+		{"go_memstats_heap_inuse_bytes", "Bytes in in-use spans.", ms.HeapInuse},
+		{"go_memstats_heap_released_bytes", "Bytes of physical memory returned to the OS.", ms.HeapReleased},
+		{"go_memstats_heap_objects", "Number of allocated heap objects.", ms.HeapObjects},
+		{"go_memstats_stack_inuse_bytes", "Bytes in stack spans.", ms.StackInuse},
+		{"go_memstats_stack_sys_bytes", "Bytes of stack memory obtained from the OS.", ms.StackSys},
+		{"go_memstats_mspan_inuse_bytes", "Bytes of allocated mspan structures.", ms.MSpanInuse},
+		{"go_memstats_mspan_sys_bytes", "Bytes of memory obtained from the OS for mspan structures.", ms.MSpanSys},
+		{"go_memstats_mcache_inuse_bytes", "Bytes of allocated mcache structures.", ms.MCacheInuse},
+		{"go_memstats_mcache_sys_bytes", "Bytes of memory obtained from the OS for mcache structures.", ms.MCacheSys},
+		{"go_memstats_buck_hash_sys_bytes", "Bytes of memory in profiling bucket hash tables.", ms.BuckHashSys},
+		{"go_memstats_gc_sys_bytes", "Bytes of memory in garbage collection metadata.", ms.GCSys},
+		{"go_memstats_other_sys_bytes", "Bytes of memory in miscellaneous off-heap runtime allocations.", ms.OtherSys},
+		{"go_memstats_next_gc_bytes", "Target heap size of the next GC cycle.", ms.NextGC},
+	} {
+		m.family(g.name, "gauge", g.help, sample{value: float64(g.value)})
+	}
+	for _, c := range []struct {
+		name, help string
+		value      uint64
+	}{
+		{"go_memstats_total_alloc_bytes", "Cumulative bytes allocated for heap objects.", ms.TotalAlloc},
+		{"go_memstats_lookups", "Number of pointer lookups performed by the runtime.", ms.Lookups},
+		{"go_memstats_mallocs", "Cumulative count of heap objects allocated.", ms.Mallocs},
+		{"go_memstats_frees", "Cumulative count of heap objects freed.", ms.Frees},
+		{"go_memstats_gc_cycles", "Number of completed GC cycles.", uint64(ms.NumGC)},
+		{"go_memstats_forced_gc_cycles", "Number of GC cycles forced by the application.", uint64(ms.NumForcedGC)},
+	} {
+		m.family(c.name, "counter", c.help, sample{value: float64(c.value)})
+	}
+	m.family("go_memstats_gc_pause_seconds", "counter", "Cumulative time in GC stop-the-world pauses.",
+		sample{value: float64(ms.PauseTotalNs) / 1e9})
+	m.family("go_memstats_gc_cpu_fraction", "gauge", "Fraction of the available CPU time used by the GC since the program started.",
+		sample{value: ms.GCCPUFraction})
+	m.family("go_memstats_last_gc_time_seconds", "gauge", "Time of the last GC cycle since the Unix epoch, 0 if none.",
+		sample{value: float64(ms.LastGC) / 1e9})
+	m.family("go_memstats_enable_gc", "gauge", "Whether the GC is enabled.", sample{value: bool01(ms.EnableGC)})
+	m.family("go_memstats_debug_gc", "gauge", "Whether the GC debug mode is enabled.", sample{value: bool01(ms.DebugGC)})
+	var mallocs, frees []sample
+	for _, size := range ms.BySize {
+		labels := [][2]string{{"size", strconv.FormatUint(uint64(size.Size), 10)}}
+		mallocs = append(mallocs, sample{labels: labels, value: float64(size.Mallocs)})
+		frees = append(frees, sample{labels: labels, value: float64(size.Frees)})
+	}
+	m.family("go_memstats_by_size_mallocs", "counter", "Cumulative count of heap objects allocated, by size class.", mallocs...)
+	m.family("go_memstats_by_size_frees", "counter", "Cumulative count of heap objects freed, by size class.", frees...)
+
+	// Summarize the GC pauses with their quantiles, like client_golang does
+	gs := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&gs)
+	var pauses []sample
+	for i, quantile := range []string{"0", "0.25", "0.5", "0.75", "1"} {
+		pauses = append(pauses, sample{labels: [][2]string{{"quantile", quantile}}, value: gs.PauseQuantiles[i].Seconds()})
+	}
+	pauses = append(pauses,
+		sample{suffix: "_sum", value: gs.PauseTotal.Seconds()},
+		sample{suffix: "_count", value: float64(gs.NumGC)})
+	m.family("go_gc_duration_seconds", "summary", "A summary of the wall-time pause (stop-the-world) duration in garbage collection cycles.", pauses...)
+	lastGC := 0.0
+	if gs.NumGC > 0 {
+		lastGC = float64(gs.LastGC.UnixNano()) / 1e9
+	}
+	m.family("go_gc_last_time_seconds", "gauge", "Time of the last GC cycle since the Unix epoch, 0 if none.", sample{value: lastGC})
+
+	m.family("go_goroutines", "gauge", "Number of goroutines that currently exist.", sample{value: float64(runtime.NumGoroutine())})
+	m.family("go_threads", "gauge", "Number of OS threads created.", sample{value: float64(pprof.Lookup("threadcreate").Count())})
+	m.family("go_info", "gauge", "Information about the Go environment.",
+		sample{labels: [][2]string{{"version", runtime.Version()}}, value: 1})
+	if info, ok := debug.ReadBuildInfo(); ok {
+		m.family("go_build_info", "gauge", "Build information about the main Go module.", sample{labels: [][2]string{
+			{"checksum", info.Main.Sum}, {"path", info.Main.Path}, {"version", info.Main.Version},
+		}, value: 1})
+	}
+
+	contentType := prometheusType
+	if openMetrics {
+		m.b.WriteString("# EOF\n")
+		contentType = openMetricsType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(m.b.String()))
+}
+
+// sample is a sample of a metric family.
+type sample struct {
+	suffix string      // Suffix of the sample name, e.g. "_sum" for a summary
+	labels [][2]string // Names and values of the labels
+	value  float64
+}
+
+// metricsWriter writes metric families in the Prometheus text format, or in the OpenMetrics one.
+type metricsWriter struct {
+	b           strings.Builder
+	openMetrics bool
+}
+
+// family writes a metric family with its help and type, and its samples. The samples of a counter are suffixed
+// with "_total", which the family name is too in the Prometheus text format.
+func (m *metricsWriter) family(name, typ, help string, samples ...sample) {
+	if len(samples) == 0 {
+		return
+	}
+	family := name
+	if typ == "counter" && !m.openMetrics {
+		family += "_total"
+	}
+	m.b.WriteString("# HELP " + family + " " + strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help) + "\n")
+	m.b.WriteString("# TYPE " + family + " " + typ + "\n")
+	for _, s := range samples {
+		m.b.WriteString(name + s.suffix)
+		if typ == "counter" {
+			m.b.WriteString("_total")
+		}
+		if len(s.labels) > 0 {
+			m.b.WriteByte('{')
+			for i, label := range s.labels {
+				if i > 0 {
+					m.b.WriteByte(',')
+				}
+				m.b.WriteString(label[0] + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(label[1]) + `"`)
+			}
+			m.b.WriteByte('}')
+		}
+		m.b.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+	}
+}
+
+// bool01 returns 1 for true and 0 for false.
+func bool01(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
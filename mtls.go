@@ -0,0 +1,126 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the authentication of clients by their TLS client certificate.
+package pprof4svc
+
+import (
+	"crypto/x509"
+	"net/http"
+	"time"
+)
+
+// ClientCertConfig configures the Authenticator returned by ClientCert.
+// A certificate is accepted if it matches any entry of the allowlists, or any certificate if they are all empty.
+type ClientCertConfig struct {
+	Roots *x509.CertPool // CAs verifying the certificate; if nil, it must have been verified by the TLS server
+
+	Subjects  []string // Allowed subjects, as a common name or a distinguished name, e.g. "CN=ops,O=Example"
+	DNSNames  []string // Allowed DNS names of the subject alternative names
+	Emails    []string // Allowed email addresses of the subject alternative names
+	SPIFFEIDs []string // Allowed SPIFFE IDs, the spiffe:// URIs of the subject alternative names
+
+	Scopes []Scope // Scopes granted to the clients; nil grants every scope
+}
+
+// ClientCert returns an Authenticator accepting requests made over TLS with a client certificate
+// verified by the CAs and matching the allowlists of cfg. The principal is named after the SPIFFE ID,
+// or else the common name, of the certificate, and its credential expires with the certificate.
+//
+// The TLS server must request client certificates: set ServerConfig.ClientCAs for ListenAndServe,
+// or the ClientCAs and ClientAuth of the tls.Config of the server the Gin engine runs on.
+func ClientCert(cfg ClientCertConfig) Authenticator {
+	cfg.Subjects = append([]string(nil), cfg.Subjects...)
+	cfg.DNSNames = append([]string(nil), cfg.DNSNames...)
+	cfg.Emails = append([]string(nil), cfg.Emails...)
+	cfg.SPIFFEIDs = append([]string(nil), cfg.SPIFFEIDs...)
+	if cfg.Scopes != nil {
+		cfg.Scopes = append([]Scope{}, cfg.Scopes...)
+	}
+	return &clientCert{cfg}
+}
+
+// clientCert is the Authenticator returned by ClientCert.
+type clientCert struct {
+	cfg ClientCertConfig
+}
+
+// Authenticate implements Authenticator.
+func (c *clientCert) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	cert := r.TLS.PeerCertificates[0]
+	if c.cfg.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert0 := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(cert0)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:         c.cfg.Roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			return nil, ErrInvalidCredential
+		}
+	} else if len(r.TLS.VerifiedChains) == 0 {
+		// The server only requested the certificate, without verifying it
+		return nil, ErrInvalidCredential
+	}
+	if !time.Now().Before(cert.NotAfter) {
+		return nil, ErrExpiredCredential
+	}
+	spiffeID := ""
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			spiffeID = uri.String()
+		}
+	}
+	if !c.matches(cert, spiffeID) {
+		return nil, ErrInvalidCredential
+	}
+	name := spiffeID
+	if name == "" {
+		name = cert.Subject.CommonName
+	}
+	return &Principal{Name: name, Scopes: c.cfg.Scopes, Expires: cert.NotAfter}, nil
+}
+
+// matches reports whether the certificate, with the given SPIFFE ID, matches the allowlists.
+func (c *clientCert) matches(cert *x509.Certificate, spiffeID string) bool {
+	if len(c.cfg.Subjects)+len(c.cfg.DNSNames)+len(c.cfg.Emails)+len(c.cfg.SPIFFEIDs) == 0 {
+		return true
+	}
+	for _, subject := range c.cfg.Subjects {
+		if subject == cert.Subject.CommonName || subject == cert.Subject.String() {
+			return true
+		}
+	}
+	for _, id := range c.cfg.SPIFFEIDs {
+		if id == spiffeID && id != "" {
+			return true
+		}
+	}
+	return contains(c.cfg.DNSNames, cert.DNSNames) || contains(c.cfg.Emails, cert.EmailAddresses)
+}
+
+// contains reports whether the allowlist contains any of the values.
+func contains(allowlist, values []string) bool {
+	for _, allowed := range allowlist {
+		for _, value := range values {
+			if allowed == value {
+				return true
+			}
+		}
+	}
+	return false
+}
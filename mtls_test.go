@@ -0,0 +1,240 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testCA is a self-signed CA issuing the certificates of the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+// newTestCA generates a self-signed CA.
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue issues a certificate for the template, completed with a serial number, a key and a validity.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = serial
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// clientCertificate issues a client certificate with the given common name and SPIFFE ID, if any.
+func (ca *testCA) clientCertificate(t *testing.T, name, spiffeID string) tls.Certificate {
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if spiffeID != "" {
+		u, err := url.Parse(spiffeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	return ca.issue(t, tmpl)
+}
+
+// certClient returns a client trusting the pool and presenting the certificates, if any.
+func certClient(pool *x509.CertPool, certs ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+}
+
+// certPlugin returns a plugin authenticating by client certificates only, allowing the "ops" subject
+// and a SPIFFE ID.
+func certPlugin(t *testing.T) *plugin {
+	t.Helper()
+	p, err := Plugin("", WithAuthenticators(ClientCert(ClientCertConfig{
+		Subjects:  []string{"ops"},
+		SPIFFEIDs: []string{"spiffe://example.org/oncall"},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// checkCertAuth checks the statuses of requests to the pprof index at the url with various client certificates.
+func checkCertAuth(t *testing.T, ca *testCA, pool *x509.CertPool, url string) {
+	t.Helper()
+	other := newTestCA(t)
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		status int
+	}{
+		{"no certificate", nil, http.StatusUnauthorized},
+		{"allowed subject", []tls.Certificate{ca.clientCertificate(t, "ops", "")}, http.StatusOK},
+		{"allowed SPIFFE ID", []tls.Certificate{ca.clientCertificate(t, "svc", "spiffe://example.org/oncall")}, http.StatusOK},
+		{"other subject", []tls.Certificate{ca.clientCertificate(t, "dev", "")}, http.StatusForbidden},
+		{"other SPIFFE ID", []tls.Certificate{ca.clientCertificate(t, "svc", "spiffe://example.org/dev")}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		resp, err := certClient(pool, test.certs...).Get(url)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+	}
+	// A certificate of another CA is refused by the TLS handshake
+	if resp, err := certClient(pool, other.clientCertificate(t, "ops", "")).Get(url); err == nil {
+		resp.Body.Close()
+		t.Errorf("certificate of another CA: got status %d, want a handshake error", resp.StatusCode)
+	}
+}
+
+func TestClientCertListenAndServe(t *testing.T) {
+	ca := newTestCA(t)
+	server := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	p := certPlugin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.ListenAndServe(ctx, ServerConfig{
+			Addr:      addr,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{server}},
+			ClientCAs: ca.pool,
+		})
+	}()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Errorf("ListenAndServe: %v", err)
+		}
+	}()
+	url := "https://" + addr + p.prefixes()[0] + pprofIndexRoute
+	// Wait for the server to listen
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkCertAuth(t, ca, ca.pool, url)
+}
+
+func TestClientCertGin(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	ca := newTestCA(t)
+	p := certPlugin(t)
+	engine := gin.New()
+	p.Plug(engine)
+	srv := httptest.NewUnstartedServer(engine)
+	srv.TLS = &tls.Config{ClientCAs: ca.pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	checkCertAuth(t, ca, pool, srv.URL+p.prefixes()[0]+pprofIndexRoute)
+}
+
+func TestClientCertExpired(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "ops"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotBefore:   time.Now().Add(-2 * time.Hour),
+		NotAfter:    time.Now().Add(-time.Hour),
+	})
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	principal, err := ClientCert(ClientCertConfig{Roots: ca.pool}).Authenticate(r)
+	if principal != nil || err == nil {
+		t.Errorf("expired certificate: got principal %v and error %v, want a rejection", principal, err)
+	}
+}
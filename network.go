@@ -0,0 +1,126 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the restriction of the plugin to networks, and the client address behind proxies.
+package pprof4svc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseNetworks parses networks given in CIDR notation, or as single addresses.
+func parseNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		if addr, err := netip.ParseAddr(network); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("pprof4svc: invalid network %q", network)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// inNetworks reports whether the address is in any of the networks.
+func inNetworks(addr netip.Addr, networks []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// admits reports whether the plugin answers a request, by the address of its client.
+// Every request is admitted unless networks are allowed. A request over a Unix socket, which has no address,
+// is checked by the address its forwarding headers tell if the socket is a trusted proxy and it has them;
+// any other request over a Unix socket is admitted only if Unix sockets are trusted.
+func (p *plugin) admits(r *http.Request) bool {
+	if p.allowedNetworks == nil {
+		return true
+	}
+	if unixPeer(r) && !(p.unixProxy && forwarded(r)) {
+		return p.unixTrusted
+	}
+	addr, ok := p.clientAddr(r)
+	return ok && inNetworks(addr, p.allowedNetworks)
+}
+
+// unixPeer reports whether a request came over a Unix socket, whose peers have no address.
+func unixPeer(r *http.Request) bool {
+	return r.RemoteAddr == "" || r.RemoteAddr == "@"
+}
+
+// forwarded reports whether a request carries forwarding headers telling the address of its client.
+func forwarded(r *http.Request) bool {
+	return r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != ""
+}
+
+// clientAddr returns the address of the client of a request. If the request comes from a trusted proxy,
+// including a Unix socket if it is trusted as a proxy, it is the rightmost address of the X-Forwarded-For header
+// that is not a trusted proxy, or else the address of the X-Real-IP header; otherwise it is the remote address
+// of the request. A request over a Unix socket has no client address unless the socket is a trusted proxy
+// and the request has either header.
+func (p *plugin) clientAddr(r *http.Request) (netip.Addr, bool) {
+	var addr netip.Addr
+	if unixPeer(r) && !p.unixProxy {
+		return netip.Addr{}, false
+	}
+	if !unixPeer(r) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if addr, err = netip.ParseAddr(host); err != nil {
+			return netip.Addr{}, false
+		}
+		if !inNetworks(addr, p.trustedProxies) {
+			return addr, true
+		}
+	}
+	// Walk the proxies back from the nearest one, until one is not trusted
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			hops = []string{realIP}
+		}
+	}
+	if len(hops) == 0 && !addr.IsValid() {
+		return netip.Addr{}, false
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop
+		if !inNetworks(addr, p.trustedProxies) {
+			break
+		}
+	}
+	return addr, true
+}
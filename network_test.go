@@ -0,0 +1,121 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// forwardedRequest returns a request from the remote address with the given X-Forwarded-For and X-Real-IP headers.
+func forwardedRequest(remoteAddr string, xff []string, realIP string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, pprofIndexRoute, nil)
+	r.RemoteAddr = remoteAddr
+	for _, header := range xff {
+		r.Header.Add("X-Forwarded-For", header)
+	}
+	if realIP != "" {
+		r.Header.Set("X-Real-IP", realIP)
+	}
+	return r
+}
+
+func TestClientAddr(t *testing.T) {
+	p, err := Plugin("token", WithTrustedProxies("10.0.0.0/8", "::1", "unix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		want       string // Client address, or empty if there is none
+	}{
+		{"direct client", "192.0.2.1:1234", nil, "", "192.0.2.1"},
+		{"untrusted client forging headers", "192.0.2.1:1234", []string{"203.0.113.9"}, "203.0.113.8", "192.0.2.1"},
+		{"trusted proxy without headers", "10.0.0.1:1234", nil, "", "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"203.0.113.9"}, "", "203.0.113.9"},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"203.0.113.9, 10.0.0.3", "10.0.0.2"}, "", "203.0.113.9"},
+		{"spoofed hop behind the client", "10.0.0.1:1234", []string{"198.51.100.7, 203.0.113.9, 10.0.0.2"}, "", "203.0.113.9"},
+		{"only trusted hops", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"X-Real-IP", "10.0.0.1:1234", nil, "203.0.113.9", "203.0.113.9"},
+		{"X-Forwarded-For before X-Real-IP", "10.0.0.1:1234", []string{"203.0.113.9"}, "203.0.113.8", "203.0.113.9"},
+		{"invalid hop", "10.0.0.1:1234", []string{"203.0.113.9, bogus"}, "", ""},
+		{"IPv6 proxy", "[::1]:1234", []string{"2001:db8::1"}, "", "2001:db8::1"},
+		{"IPv4-mapped proxy", "[::ffff:10.0.0.1]:1234", []string{"203.0.113.9"}, "", "203.0.113.9"},
+		{"Unix socket proxy", "@", []string{"203.0.113.9"}, "", "203.0.113.9"},
+		{"Unix socket proxy without headers", "@", nil, "", ""},
+		{"Unix socket proxy with an empty remote address", "", nil, "203.0.113.9", "203.0.113.9"},
+	}
+	for _, test := range tests {
+		addr, ok := p.clientAddr(forwardedRequest(test.remoteAddr, test.xff, test.realIP))
+		got := ""
+		if ok {
+			got = addr.String()
+		}
+		if got != test.want {
+			t.Errorf("%s: got client address %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// Unless it is a trusted proxy, the forwarding headers of a Unix socket peer are ignored
+	p, err = Plugin("token", WithTrustedProxies("10.0.0.0/8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, ok := p.clientAddr(forwardedRequest("@", []string{"203.0.113.9"}, "")); ok {
+		t.Errorf("untrusted Unix socket: got client address %s, want none", addr)
+	}
+}
+
+func TestAdmits(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		remoteAddr string
+		xff        []string
+		want       bool
+	}{
+		{"no allowlist", nil, "203.0.113.9:1234", nil, true},
+		{"allowed client", []Option{WithAllowedNetworks("10.0.0.0/8")}, "10.1.2.3:1234", nil, true},
+		{"other client", []Option{WithAllowedNetworks("10.0.0.0/8")}, "203.0.113.9:1234", nil, false},
+		{"untrusted forwarded header", []Option{WithAllowedNetworks("10.0.0.0/8")}, "203.0.113.9:1234", []string{"10.1.2.3"}, false},
+		{"trusted proxy of an allowed client", []Option{WithAllowedNetworks("192.0.2.0/24"), WithTrustedProxies("10.0.0.1")}, "10.0.0.1:1234", []string{"192.0.2.7"}, true},
+		{"trusted proxy of another client", []Option{WithAllowedNetworks("192.0.2.0/24"), WithTrustedProxies("10.0.0.1")}, "10.0.0.1:1234", []string{"203.0.113.9"}, false},
+		{"Unix socket forging headers", []Option{WithAllowedNetworks("10.0.0.0/8")}, "@", []string{"10.1.2.3"}, false},
+		{"Unix socket without headers", []Option{WithAllowedNetworks("10.0.0.0/8")}, "@", nil, false},
+		{"trusted Unix socket", []Option{WithAllowedNetworks("10.0.0.0/8"), WithUnixSocketTrusted()}, "@", []string{"8.8.8.8"}, true},
+		{"Unix socket proxy of an allowed client", []Option{WithAllowedNetworks("10.0.0.0/8"), WithTrustedProxies("unix")}, "@", []string{"10.1.2.3"}, true},
+		{"Unix socket proxy of another client", []Option{WithAllowedNetworks("10.0.0.0/8"), WithTrustedProxies("unix")}, "@", []string{"8.8.8.8"}, false},
+		{"Unix socket proxy without headers", []Option{WithAllowedNetworks("10.0.0.0/8"), WithTrustedProxies("unix")}, "@", nil, false},
+		{"trusted Unix socket proxy without headers", []Option{WithAllowedNetworks("10.0.0.0/8"), WithTrustedProxies("unix"), WithUnixSocketTrusted()}, "@", nil, true},
+		{"trusted Unix socket proxy of another client", []Option{WithAllowedNetworks("10.0.0.0/8"), WithTrustedProxies("unix"), WithUnixSocketTrusted()}, "@", []string{"8.8.8.8"}, false},
+	}
+	for _, test := range tests {
+		p, err := Plugin("token", test.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		r := forwardedRequest(test.remoteAddr, test.xff, "")
+		if got := p.admits(r); got != test.want {
+			t.Errorf("%s: got admitted %v, want %v", test.name, got, test.want)
+		}
+		// Requests that are not admitted get the same 404 as a wrong prefix, even on the entrypoint
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if want := map[bool]int{true: http.StatusOK, false: http.StatusNotFound}[test.want]; w.Code != want {
+			t.Errorf("%s: got status %d on the entrypoint, want %d", test.name, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the functional options configuring the plugin.
+package pprof4svc
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Option configures a plugin created by Plugin. Options are validated when they are applied,
+// and Plugin reports the first invalid one.
+type Option func(p *plugin) error
+
+// Routes holds the routes of the endpoints, relative to the prefix.
+// The pprof profiles, cmdline, profile, symbol and trace live below the Pprof route,
+// where the links of the pprof index expect them.
+type Routes struct {
+	Pprof          string // Route of the pprof index, ending with a slash, "/debug/pprof/" by default
+	Mem            string // Route of the memory statistics, "/debug/mem" by default
+	GC             string // Route of the GC statistics, "/debug/gc" by default
+	Trace          string // Route of the trace control, "/debug/trace" by default
+	Logout         string // Route of the logout, "/debug/logout" by default
+	Share          string // Route minting share links, "/debug/share" by default
+	Audit          string // Route of the recent audit events, "/debug/audit" by default
+	Metrics        string // Route of the Prometheus metrics, "/debug/metrics" by default
+	RuntimeMetrics string // Route of the runtime/metrics catalog and values, "/debug/runtime-metrics" by default
+	History        string // Route of the history of the memory and GC statistics, "/debug/history" by default
+}
+
+// others returns the routes other than the Pprof route.
+func (routes Routes) others() []string {
+	return []string{routes.Mem, routes.GC, routes.Trace, routes.Logout, routes.Share, routes.Audit, routes.Metrics, routes.RuntimeMetrics, routes.History}
+}
+
+// root returns the longest path every route lives below, ending with a slash, e.g. "/debug/".
+func (routes Routes) root() string {
+	root := routes.Pprof
+	for _, route := range routes.others() {
+		for !strings.HasPrefix(route, root) {
+			root = root[:strings.LastIndex(strings.TrimSuffix(root, "/"), "/")+1]
+		}
+	}
+	return root
+}
+
+// Endpoint identifies an endpoint of the plugin.
+type Endpoint string
+
+// Endpoints of the plugin; all of them are enabled by default.
+const (
+	EndpointIndex          Endpoint = "index"           // pprof index
+	EndpointProfiles       Endpoint = "profiles"        // Named pprof profiles, e.g. heap, goroutine
+	EndpointCmdline        Endpoint = "cmdline"         // Command line arguments
+	EndpointProfile        Endpoint = "profile"         // CPU profile
+	EndpointSymbol         Endpoint = "symbol"          // Symbol lookup
+	EndpointPprofTrace     Endpoint = "pprof-trace"     // Execution trace of the pprof package
+	EndpointMem            Endpoint = "mem"             // Memory statistics
+	EndpointGC             Endpoint = "gc"              // GC statistics
+	EndpointTrace          Endpoint = "trace"           // Trace control
+	EndpointAudit          Endpoint = "audit"           // Recent audit events
+	EndpointMetrics        Endpoint = "metrics"         // Prometheus metrics
+	EndpointRuntimeMetrics Endpoint = "runtime-metrics" // runtime/metrics catalog and values
+	EndpointHistory        Endpoint = "history"         // History of the memory and GC statistics
+)
+
+// AllEndpoints lists every endpoint of the plugin.
+var AllEndpoints = []Endpoint{
+	EndpointIndex, EndpointProfiles, EndpointCmdline, EndpointProfile, EndpointSymbol,
+	EndpointPprofTrace, EndpointMem, EndpointGC, EndpointTrace, EndpointAudit, EndpointMetrics,
+	EndpointRuntimeMetrics, EndpointHistory,
+}
+
+// SafeEndpoints lists the endpoints exposing lightweight statistics only: the pprof index, the memory and
+// GC statistics and the metrics. None of them captures a profile or a trace, or reveals the command line.
+var SafeEndpoints = []Endpoint{EndpointIndex, EndpointMem, EndpointGC, EndpointMetrics, EndpointRuntimeMetrics,
+	EndpointHistory}
+
+// WithEntrypoint sets the entrypoint, "/debug/pprof/" by default. It must start with a slash.
+func WithEntrypoint(entrypoint string) Option {
+	return func(p *plugin) error {
+		if !strings.HasPrefix(entrypoint, "/") {
+			return fmt.Errorf("pprof4svc: entrypoint %q must start with a slash", entrypoint)
+		}
+		if entrypoint == "/" {
+			return fmt.Errorf("pprof4svc: entrypoint must not be the root, which the stable pprof routes would be below")
+		}
+		p.entrypoint = entrypoint
+		return nil
+	}
+}
+
+// WithPrefixParam sets the name of the route parameter capturing the prefix in the dispatcher route registered
+// with Gin, "prefix" by default. Gin refuses a parameter where a sibling route has one with another name, so
+// give the name of the app's parameter if the app has a route starting with one, e.g. "id" for "/:id/profile".
+func WithPrefixParam(name string) Option {
+	return func(p *plugin) error {
+		if name == "" || strings.ContainsAny(name, "/:*") {
+			return fmt.Errorf("pprof4svc: prefix parameter %q must be a non-empty name without '/', ':' or '*'", name)
+		}
+		p.prefixParam = name
+		return nil
+	}
+}
+
+// WithPrefix replaces the random prefix with a fixed one, e.g. read from the configuration shared by
+// all replicas of a service. It must not contain a slash other than a leading one.
+func WithPrefix(prefix string) Option {
+	return func(p *plugin) error {
+		prefix0 := strings.TrimPrefix(prefix, "/")
+		if prefix0 == "" || strings.Contains(prefix0, "/") {
+			return fmt.Errorf("pprof4svc: prefix %q must be a single non-empty path segment", prefix)
+		}
+		p.prefix, p.secret, p.window, p.shared = "/"+prefix0, nil, 0, true
+		return nil
+	}
+}
+
+// WithSharedPrefix derives the prefix from a secret shared by all replicas of a service, so that each of them
+// serves the same prefixed routes. With a positive window the prefix changes every window, in lockstep
+// on every replica; with a zero window it is derived once from the secret alone.
+func WithSharedPrefix(secret []byte, window time.Duration) Option {
+	return func(p *plugin) error {
+		if len(secret) == 0 {
+			return fmt.Errorf("pprof4svc: prefix secret must not be empty")
+		}
+		if window < 0 {
+			return fmt.Errorf("pprof4svc: prefix window %s must not be negative", window)
+		}
+		p.secret, p.window, p.shared = append([]byte(nil), secret...), window, true
+		return nil
+	}
+}
+
+// WithRoutes sets the routes of the endpoints; empty ones keep their default.
+// Routes must start with a slash and be distinct, and the Pprof route must end with one. They must also share
+// a first segment, e.g. "/debug/", below which Gin registers the dispatcher route, so that it does not shadow
+// every route of the app with two segments or more.
+func WithRoutes(routes Routes) Option {
+	return func(p *plugin) error {
+		if routes.Pprof == "" {
+			routes.Pprof = p.routes.Pprof
+		}
+		if routes.Mem == "" {
+			routes.Mem = p.routes.Mem
+		}
+		if routes.GC == "" {
+			routes.GC = p.routes.GC
+		}
+		if routes.Trace == "" {
+			routes.Trace = p.routes.Trace
+		}
+		if routes.Logout == "" {
+			routes.Logout = p.routes.Logout
+		}
+		if routes.Share == "" {
+			routes.Share = p.routes.Share
+		}
+		if routes.Audit == "" {
+			routes.Audit = p.routes.Audit
+		}
+		if routes.Metrics == "" {
+			routes.Metrics = p.routes.Metrics
+		}
+		if routes.RuntimeMetrics == "" {
+			routes.RuntimeMetrics = p.routes.RuntimeMetrics
+		}
+		if routes.History == "" {
+			routes.History = p.routes.History
+		}
+		if !strings.HasPrefix(routes.Pprof, "/") || !strings.HasSuffix(routes.Pprof, "/") {
+			return fmt.Errorf("pprof4svc: pprof route %q must start and end with a slash", routes.Pprof)
+		}
+		seen := map[string]bool{}
+		for _, route := range routes.others() {
+			if !strings.HasPrefix(route, "/") {
+				return fmt.Errorf("pprof4svc: route %q must start with a slash", route)
+			}
+			if seen[route] || strings.HasPrefix(route, routes.Pprof) {
+				return fmt.Errorf("pprof4svc: route %q collides with another route", route)
+			}
+			seen[route] = true
+		}
+		if routes.root() == "/" {
+			return fmt.Errorf("pprof4svc: routes must share a first segment, e.g. \"/debug/\"")
+		}
+		p.routes = routes
+		return nil
+	}
+}
+
+// WithEndpoints enables only the given endpoints; requests to the others get 404.
+func WithEndpoints(endpoints ...Endpoint) Option {
+	return func(p *plugin) error {
+		enabled := map[Endpoint]bool{}
+		for _, endpoint := range endpoints {
+			if !validEndpoint(endpoint) {
+				return fmt.Errorf("pprof4svc: unknown endpoint %q", endpoint)
+			}
+			enabled[endpoint] = true
+		}
+		p.endpoints = enabled
+		return nil
+	}
+}
+
+// WithoutEndpoints disables the given endpoints, e.g. EndpointCmdline whose output may contain secrets
+// passed as flags; requests to them get 404.
+func WithoutEndpoints(endpoints ...Endpoint) Option {
+	return func(p *plugin) error {
+		for _, endpoint := range endpoints {
+			if !validEndpoint(endpoint) {
+				return fmt.Errorf("pprof4svc: unknown endpoint %q", endpoint)
+			}
+			delete(p.endpoints, endpoint)
+		}
+		return nil
+	}
+}
+
+// WithSafeMode enables the SafeEndpoints only, a read-only mode that neither captures profiles
+// and traces, nor exposes the command line.
+func WithSafeMode() Option {
+	return WithEndpoints(SafeEndpoints...)
+}
+
+// WithAllowedNetworks restricts the plugin to clients in the given networks, in CIDR notation or as single
+// addresses, e.g. "127.0.0.1", "10.0.0.0/8" or "fd00::/8"; requests from other clients get 404, like those to
+// a wrong prefix. Requests over a Unix socket are refused unless WithUnixSocketTrusted is given, or the socket is
+// a trusted proxy and they have forwarding headers telling an allowed address, see WithTrustedProxies.
+func WithAllowedNetworks(networks ...string) Option {
+	return func(p *plugin) error {
+		if len(networks) == 0 {
+			return fmt.Errorf("pprof4svc: allowed networks must not be empty")
+		}
+		prefixes, err := parseNetworks(networks)
+		if err != nil {
+			return err
+		}
+		p.allowedNetworks = prefixes
+		return nil
+	}
+}
+
+// WithUnixSocketTrusted admits the requests over a Unix socket despite the allowed networks, e.g. those of local
+// clients of the socket served by ListenAndServe, since the socket's permissions already restrict its clients.
+// If the socket is also a trusted proxy, requests with forwarding headers are checked by the address they tell instead.
+func WithUnixSocketTrusted() Option {
+	return func(p *plugin) error {
+		p.unixTrusted = true
+		return nil
+	}
+}
+
+// WithTrustedProxies sets the proxies, in CIDR notation or as single addresses, whose X-Forwarded-For and
+// X-Real-IP headers tell the address of the client checked against the allowed networks. Without them,
+// the headers are ignored. The entry "unix" trusts the peers of a Unix socket as proxies, e.g. nginx proxying
+// to a "unix:" upstream; only use it if no other local process can connect to the socket, since any peer
+// could claim an allowed address.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(p *plugin) error {
+		networks := make([]string, 0, len(proxies))
+		unixProxy := false
+		for _, proxy := range proxies {
+			if proxy == "unix" {
+				unixProxy = true
+			} else {
+				networks = append(networks, proxy)
+			}
+		}
+		prefixes, err := parseNetworks(networks)
+		if err != nil {
+			return err
+		}
+		p.trustedProxies, p.unixProxy = prefixes, unixProxy
+		return nil
+	}
+}
+
+// WithLockout locks a client out after threshold consecutive failed authentications, for base at first and twice
+// as long after every further failure, up to max; locked out clients get 429 unless they have a valid session.
+// Clients are told apart by address, from behind the trusted proxies. A zero threshold disables the lockout;
+// by default clients are locked out after 5 failures, for 1s up to 15m.
+func WithLockout(threshold int, base, max time.Duration) Option {
+	return func(p *plugin) error {
+		if threshold == 0 {
+			p.lockout = nil
+			return nil
+		}
+		if threshold < 0 || base <= 0 || max < base {
+			return fmt.Errorf("pprof4svc: lockout threshold %d must not be negative, and its base %s positive and at most max %s", threshold, base, max)
+		}
+		p.lockout = &lockout{threshold: threshold, base: base, max: max}
+		return nil
+	}
+}
+
+// WithLoginLimit limits the requests to the entrypoint, from every client together; a zero limit removes it.
+// By default it admits 10 requests per second with bursts of 20.
+func WithLoginLimit(limit Limit) Option {
+	return func(p *plugin) error {
+		if err := validLimit(limit); err != nil {
+			return err
+		}
+		p.loginLimit = newLimiter(limit)
+		return nil
+	}
+}
+
+// WithLimit limits the requests to an endpoint, from every client together; a zero limit removes it.
+// By default the CPU profile and both traces are limited to one request at a time.
+func WithLimit(endpoint Endpoint, limit Limit) Option {
+	return func(p *plugin) error {
+		if !validEndpoint(endpoint) {
+			return fmt.Errorf("pprof4svc: unknown endpoint %q", endpoint)
+		}
+		if err := validLimit(limit); err != nil {
+			return err
+		}
+		p.limits[endpoint] = newLimiter(limit)
+		return nil
+	}
+}
+
+// WithAuditSinks adds sinks receiving every audit event, e.g. SlogAuditSink(slog.Default()).
+func WithAuditSinks(sinks ...AuditSink) Option {
+	return func(p *plugin) error {
+		for _, sink := range sinks {
+			if sink == nil {
+				return fmt.Errorf("pprof4svc: audit sink must not be nil")
+			}
+		}
+		p.auditSinks = append(p.auditSinks, sinks...)
+		return nil
+	}
+}
+
+// WithAuditBuffer sets the number of recent audit events served by the audit endpoint, 256 by default.
+// A zero size keeps none.
+func WithAuditBuffer(size int) Option {
+	return func(p *plugin) error {
+		if size < 0 {
+			return fmt.Errorf("pprof4svc: audit buffer size %d must not be negative", size)
+		}
+		p.audits.events = make([]AuditEvent, size)
+		return nil
+	}
+}
+
+// WithHistory samples the memory and GC statistics every interval in the background, for the history endpoint.
+// The most recent size samples are kept at full resolution, and as many older ones at each of two coarser
+// resolutions, aggregating 10 and 100 samples. Sampling calls runtime.ReadMemStats, which stops the world briefly,
+// so the interval should be a second or more. Call Close to stop the sampler.
+func WithHistory(interval time.Duration, size int) Option {
+	return func(p *plugin) error {
+		if interval <= 0 {
+			return fmt.Errorf("pprof4svc: history interval %s must be positive", interval)
+		}
+		if size <= 0 {
+			return fmt.Errorf("pprof4svc: history size %d must be positive", size)
+		}
+		p.history = newHistory(interval, size)
+		return nil
+	}
+}
+
+// WithRedirectStatus sets the status of the redirect after login, 303 by default.
+// It must be 302 or 303, the redirects that are not cached and turn the login POST into a GET.
+func WithRedirectStatus(status int) Option {
+	return func(p *plugin) error {
+		if status != http.StatusFound && status != http.StatusSeeOther {
+			return fmt.Errorf("pprof4svc: redirect status %d must be 302 or 303", status)
+		}
+		p.redirectStatus = status
+		return nil
+	}
+}
+
+// WithAuthenticators adds authenticators, consulted in order after the token for every request
+// and by the login form.
+func WithAuthenticators(authenticators ...Authenticator) Option {
+	return func(p *plugin) error {
+		for _, authenticator := range authenticators {
+			if authenticator == nil {
+				return fmt.Errorf("pprof4svc: authenticator must not be nil")
+			}
+		}
+		p.authenticators = append(p.authenticators, authenticators...)
+		return nil
+	}
+}
+
+// WithTokenSource accepts the token provided by the source as a bearer token and by the login form, like the
+// token given to Plugin. The token is loaded when the option is applied, then reloaded every reload interval in
+// the background until Close is called, or never if it is zero; after a reload, the replaced token stays valid for
+// the grace period. Unless reload is zero, a token that does not match forces a reload, at most once a second,
+// before it is rejected. Reloads, and failures to reload which keep the current token, are logged.
+// Sessions are signed with a random key unless WithSessionKey is given, since the token may change;
+// with WithPrefix or WithSharedPrefix, WithSessionKey is required then.
+func WithTokenSource(source TokenSource, reload, grace time.Duration) Option {
+	return func(p *plugin) error {
+		if source == nil {
+			return fmt.Errorf("pprof4svc: token source must not be nil")
+		}
+		if reload < 0 || grace < 0 {
+			return fmt.Errorf("pprof4svc: token reload interval %s and grace period %s must not be negative", reload, grace)
+		}
+		t := &sourcedToken{
+			source:   source,
+			reload:   reload,
+			grace:    grace,
+			logf:     func(format string, v ...any) { p.logger.Printf(format, v...) },
+			previous: map[string]time.Time{},
+			done:     make(chan struct{}),
+		}
+		if err := t.load(); err != nil {
+			return err
+		}
+		p.authenticators = append(p.authenticators, t)
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the plugin, log.Default() by default.
+func WithLogger(logger *log.Logger) Option {
+	return func(p *plugin) error {
+		if logger == nil {
+			return fmt.Errorf("pprof4svc: logger must not be nil")
+		}
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithSessionKey sets the key signing the sessions issued by the login. Replicas sharing the key
+// accept the sessions issued by each other. By default the key is derived from the token, or random
+// if there is none.
+func WithSessionKey(key []byte) Option {
+	return func(p *plugin) error {
+		if len(key) < 16 {
+			return fmt.Errorf("pprof4svc: session key must be at least 16 bytes long")
+		}
+		p.sessionKey = append([]byte(nil), key...)
+		return nil
+	}
+}
+
+// WithMaxShareTTL sets the longest lifetime of a share link, 24h by default.
+func WithMaxShareTTL(ttl time.Duration) Option {
+	return func(p *plugin) error {
+		if ttl <= 0 {
+			return fmt.Errorf("pprof4svc: max share TTL %s must be positive", ttl)
+		}
+		p.maxShareTTL = ttl
+		return nil
+	}
+}
+
+// WithSessionTTL sets the lifetime of the sessions issued by the login, 1h by default.
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(p *plugin) error {
+		if ttl <= 0 {
+			return fmt.Errorf("pprof4svc: session TTL %s must be positive", ttl)
+		}
+		p.sessionTTL = ttl
+		return nil
+	}
+}
+
+// WithTraceDuration sets the duration of a trace captured without the "dur" query parameter, 10s by default.
+func WithTraceDuration(duration time.Duration) Option {
+	return func(p *plugin) error {
+		if duration <= 0 {
+			return fmt.Errorf("pprof4svc: trace duration %s must be positive", duration)
+		}
+		p.traceDuration = duration
+		return nil
+	}
+}
+
+// WithMaxTraceDuration sets the longest trace that can be requested with the "dur" query parameter;
+// requests for longer ones get 400. Traces are not limited by default.
+func WithMaxTraceDuration(duration time.Duration) Option {
+	return func(p *plugin) error {
+		if duration <= 0 {
+			return fmt.Errorf("pprof4svc: max trace duration %s must be positive", duration)
+		}
+		p.maxTraceDuration = duration
+		return nil
+	}
+}
+
+// WithMaxProfileDuration sets the longest CPU profile, delta profile or pprof execution trace that can be requested
+// with the "seconds" query parameter; requests for longer ones get 400. They are not limited by default.
+func WithMaxProfileDuration(duration time.Duration) Option {
+	return func(p *plugin) error {
+		if duration <= 0 {
+			return fmt.Errorf("pprof4svc: max profile duration %s must be positive", duration)
+		}
+		p.maxProfileDuration = duration
+		return nil
+	}
+}
+
+// WithJSONValues sets the values of the "json" query parameter, compared case-insensitively,
+// that select JSON output on the memory and GC statistics endpoints; "1", "t" and "true" by default.
+func WithJSONValues(values ...string) Option {
+	return func(p *plugin) error {
+		if len(values) == 0 {
+			return fmt.Errorf("pprof4svc: json values must not be empty")
+		}
+		p.jsonValues = map[string]bool{}
+		for _, value := range values {
+			if value == "" {
+				return fmt.Errorf("pprof4svc: json value must not be empty")
+			}
+			p.jsonValues[strings.ToLower(value)] = true
+		}
+		return nil
+	}
+}
+
+// validLimit returns an error if the limit is negative.
+func validLimit(limit Limit) error {
+	if limit.Concurrency < 0 || limit.Rate < 0 || limit.Burst < 0 {
+		return fmt.Errorf("pprof4svc: limit %+v must not be negative", limit)
+	}
+	return nil
+}
+
+// validEndpoint reports whether the endpoint is one of the plugin.
+func validEndpoint(endpoint Endpoint) bool {
+	for _, endpoint0 := range AllEndpoints {
+		if endpoint == endpoint0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{"defaults", nil, false},
+		{"entrypoint", []Option{WithEntrypoint("/admin/pprof")}, false},
+		{"relative entrypoint", []Option{WithEntrypoint("admin")}, true},
+		{"root entrypoint", []Option{WithEntrypoint("/")}, true},
+		{"prefix parameter", []Option{WithPrefixParam("id")}, false},
+		{"empty prefix parameter", []Option{WithPrefixParam("")}, true},
+		{"prefix parameter with a colon", []Option{WithPrefixParam(":id")}, true},
+		{"prefix", []Option{WithPrefix("/fixed")}, false},
+		{"empty prefix", []Option{WithPrefix("/")}, true},
+		{"prefix of two segments", []Option{WithPrefix("/a/b")}, true},
+		{"shared prefix", []Option{WithSharedPrefix([]byte("secret"), time.Hour)}, false},
+		{"shared prefix without a secret", []Option{WithSharedPrefix(nil, time.Hour)}, true},
+		{"shared prefix with a negative window", []Option{WithSharedPrefix([]byte("secret"), -time.Hour)}, true},
+		{"routes", []Option{WithRoutes(Routes{Mem: "/debug/stats/mem"})}, false},
+		{"routes below another root", []Option{WithRoutes(routesBelow("/admin/pprof/", "/admin/"))}, false},
+		{"routes without a common first segment", []Option{WithRoutes(Routes{Mem: "/stats/mem"})}, true},
+		{"pprof route without a trailing slash", []Option{WithRoutes(Routes{Pprof: "/debug/pprof"})}, true},
+		{"relative route", []Option{WithRoutes(Routes{GC: "debug/gc"})}, true},
+		{"duplicate routes", []Option{WithRoutes(Routes{GC: "/debug/mem"})}, true},
+		{"route below the pprof route", []Option{WithRoutes(Routes{GC: "/debug/pprof/gc"})}, true},
+		{"endpoints", []Option{WithEndpoints(EndpointIndex, EndpointMem)}, false},
+		{"unknown endpoint", []Option{WithEndpoints("other")}, true},
+		{"unknown endpoint to disable", []Option{WithoutEndpoints("other")}, true},
+		{"allowed networks", []Option{WithAllowedNetworks("10.0.0.0/8", "::1")}, false},
+		{"no allowed networks", []Option{WithAllowedNetworks()}, true},
+		{"invalid network", []Option{WithAllowedNetworks("10.0.0.0/33")}, true},
+		{"trusted proxies", []Option{WithTrustedProxies("10.0.0.1", "unix")}, false},
+		{"invalid trusted proxy", []Option{WithTrustedProxies("proxy")}, true},
+		{"lockout", []Option{WithLockout(3, time.Second, time.Minute)}, false},
+		{"no lockout", []Option{WithLockout(0, 0, 0)}, false},
+		{"lockout longer than its max", []Option{WithLockout(3, time.Minute, time.Second)}, true},
+		{"negative lockout threshold", []Option{WithLockout(-1, time.Second, time.Minute)}, true},
+		{"login limit", []Option{WithLoginLimit(Limit{Rate: 1})}, false},
+		{"negative login limit", []Option{WithLoginLimit(Limit{Rate: -1})}, true},
+		{"endpoint limit", []Option{WithLimit(EndpointMem, Limit{Concurrency: 2})}, false},
+		{"limit of an unknown endpoint", []Option{WithLimit("other", Limit{Concurrency: 2})}, true},
+		{"nil audit sink", []Option{WithAuditSinks(nil)}, true},
+		{"negative audit buffer", []Option{WithAuditBuffer(-1)}, true},
+		{"history", []Option{WithHistory(time.Hour, 10)}, false},
+		{"history without an interval", []Option{WithHistory(0, 10)}, true},
+		{"history without samples", []Option{WithHistory(time.Hour, 0)}, true},
+		{"redirect status", []Option{WithRedirectStatus(302)}, false},
+		{"permanent redirect status", []Option{WithRedirectStatus(301)}, true},
+		{"nil authenticator", []Option{WithAuthenticators(nil)}, true},
+		{"nil token source", []Option{WithTokenSource(nil, 0, 0)}, true},
+		{"negative token reload", []Option{WithTokenSource(StaticToken("other"), -time.Second, 0)}, true},
+		{"empty token", []Option{WithTokenSource(StaticToken(""), 0, 0)}, true},
+		{"nil logger", []Option{WithLogger(nil)}, true},
+		{"short session key", []Option{WithSessionKey([]byte("short"))}, true},
+		{"session TTL", []Option{WithSessionTTL(0)}, true},
+		{"max share TTL", []Option{WithMaxShareTTL(-time.Hour)}, true},
+		{"trace duration", []Option{WithTraceDuration(0)}, true},
+		{"max trace duration", []Option{WithMaxTraceDuration(0)}, true},
+		{"trace duration above the max", []Option{WithTraceDuration(time.Minute), WithMaxTraceDuration(time.Second)}, true},
+		{"max profile duration", []Option{WithMaxProfileDuration(0)}, true},
+		{"json values", []Option{WithJSONValues("yes")}, false},
+		{"no json values", []Option{WithJSONValues()}, true},
+		{"empty json value", []Option{WithJSONValues("")}, true},
+	}
+	for _, test := range tests {
+		p, err := Plugin("token", test.opts...)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want an error %v", test.name, err, test.wantErr)
+		}
+		if p != nil {
+			p.Close()
+		}
+	}
+}
+
+// routesBelow returns routes with the given pprof route and every other route below dir.
+func routesBelow(pprof, dir string) Routes {
+	return Routes{Pprof: pprof, Mem: dir + "mem", GC: dir + "gc", Trace: dir + "trace", Logout: dir + "logout",
+		Share: dir + "share", Audit: dir + "audit", Metrics: dir + "metrics", RuntimeMetrics: dir + "runtime-metrics",
+		History: dir + "history"}
+}
+
+func TestRoutesRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes Routes
+		want   string
+	}{
+		{"defaults", DefaultPlugin("token").routes, "/debug/"},
+		{"pprof route deeper than the others", routesBelow("/debug/x/pprof/", "/debug/"), "/debug/"},
+		{"routes sharing two segments", routesBelow("/a/b/pprof/", "/a/b/"), "/a/b/"},
+		{"routes with other first segments", routesBelow("/debug/pprof/", "/stats/"), "/"},
+		{"routes sharing a segment only in part", routesBelow("/debug/pprof/", "/debugging/"), "/"},
+	}
+	for _, test := range tests {
+		if got := test.routes.root(); got != test.want {
+			t.Errorf("%s: got root %q, want %q", test.name, got, test.want)
+		}
+	}
+}
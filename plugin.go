@@ -9,122 +9,389 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package pprof4svc provides a Gin-based plugin for integrating pprof, memory, GC, and trace endpoints
+// Package pprof4svc provides a plugin for integrating pprof, memory, GC, and trace endpoints
 // into an HTTP service with token-based authentication and randomized route prefixes for security.
+// The plugin is a plain http.Handler; Plug and Mount register it with Gin.
 package pprof4svc
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
-	"math/rand"
+	"log"
 	"net/http"
 	"net/http/pprof"
-
-	"github.com/gin-gonic/gin"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Constants defining the routes for pprof, memory, GC, and trace endpoints.
+// Constants defining the default routes for pprof, memory, GC, and trace endpoints.
 const (
-	pprofIndexRoute   = "/debug/pprof/"        // Base route for pprof index
-	pprofNameRoute    = "/debug/pprof/:name"   // Route for specific pprof profiles (e.g., heap, goroutine)
-	pprofCmdlineRoute = "/debug/pprof/cmdline" // Route for command line arguments
-	pprofProfileRoute = "/debug/pprof/profile" // Route for CPU profile
-	pprofSymbolRoute  = "/debug/pprof/symbol"  // Route for symbol lookup
-	pprofTraceRoute   = "/debug/pprof/trace"   // Route for execution trace
-	memRoute          = "/debug/mem"           // Route for memory statistics
-	gcRoute           = "/debug/gc"            // Route for GC statistics
-	traceRoute        = "/debug/trace"         // Route for trace control
+	pprofIndexRoute     = "/debug/pprof/"          // Base route for pprof index, profiles, cmdline, profile, symbol and trace
+	memRoute            = "/debug/mem"             // Route for memory statistics
+	gcRoute             = "/debug/gc"              // Route for GC statistics
+	traceRoute          = "/debug/trace"           // Route for trace control
+	logoutRoute         = "/debug/logout"          // Route for logout
+	shareRoute          = "/debug/share"           // Route for minting share links
+	auditRoute          = "/debug/audit"           // Route for the recent audit events
+	metricsRoute        = "/debug/metrics"         // Route for the Prometheus metrics
+	runtimeMetricsRoute = "/debug/runtime-metrics" // Route for the runtime/metrics catalog and values
+	historyRoute        = "/debug/history"         // Route for the history of the memory and GC statistics
 )
 
 // plugin represents the configuration for the pprof service plugin.
-// It holds the entrypoint, authentication token, and prefixed routes for various endpoints.
+// It holds the entrypoint, the authenticators, and the current prefix of the routes for various endpoints.
 type plugin struct {
-	entrypoint   string // Main entrypoint for accessing the pprof service
-	token        string // Token for authenticating access to the pprof service
-	prefix       string // Random prefix for securing routes
-	pprofIndex   string // Prefixed route for pprof index
-	pprofName    string // Prefixed route for specific pprof profiles
-	pprofCmdline string // Prefixed route for command line arguments
-	pprofProfile string // Prefixed route for CPU profile
-	pprofSymbol  string // Prefixed route for symbol lookup
-	pprofTrace   string // Prefixed route for execution trace
-	memRoute     string // Prefixed route for memory statistics
-	gcRoute      string // Prefixed route for GC statistics
-	traceRoute   string // Prefixed route for trace control
+	entrypoint         string                // Main entrypoint for accessing the pprof service
+	prefixParam        string                // Name of the route parameter capturing the prefix in the dispatcher route registered with Gin
+	authenticators     []Authenticator       // Authenticators consulted in order for every request
+	sessionKey         []byte                // Key signing the sessions issued by the login
+	routes             Routes                // Routes of the endpoints, relative to the prefix
+	endpoints          map[Endpoint]bool     // Enabled endpoints
+	redirectStatus     int                   // Status of the redirect after login
+	sessionTTL         time.Duration         // Lifetime of the sessions issued by the login
+	revoked            expiringSet           // Sessions revoked by a logout
+	maxShareTTL        time.Duration         // Longest lifetime of a share link
+	usedLinks          expiringSet           // Nonces of the single-use share links already used
+	allowedNetworks    []netip.Prefix        // Networks the plugin answers; every one if nil
+	trustedProxies     []netip.Prefix        // Proxies whose forwarding headers are trusted
+	unixProxy          bool                  // Whether the peers of a Unix socket are trusted proxies
+	unixTrusted        bool                  // Whether requests over a Unix socket are admitted despite the allowed networks
+	lockout            *lockout              // Lockout of the clients failing to authenticate; none if nil
+	loginLimit         *limiter              // Limit of the requests to the entrypoint; none if nil
+	limits             map[Endpoint]*limiter // Limits of the requests to the endpoints
+	audits             auditLog              // Most recent audit events
+	auditSinks         []AuditSink           // Sinks receiving every audit event
+	logger             *log.Logger           // Logger of the plugin
+	traceDuration      time.Duration         // Duration of a trace captured without the "dur" query parameter
+	maxTraceDuration   time.Duration         // Longest trace that can be requested, unlimited if zero
+	maxProfileDuration time.Duration         // Longest profile or pprof trace that can be requested, unlimited if zero
+	jsonValues         map[string]bool       // Values of the "json" query parameter selecting JSON output
+	history            *history              // History of the memory and GC statistics; none if nil
+	snapshots          snapshots             // Most recent snapshots of the memory and GC statistics
+	shared             bool                  // Whether the prefix is shared by replicas, set with WithPrefix or WithSharedPrefix
+	lock               sync.RWMutex          // Guards the prefix fields, which change on rotation
+	prefix             string                // Random or fixed prefix for securing routes
+	secret             []byte                // Shared secret the prefix is derived from instead, if set
+	window             time.Duration         // Time window after which the prefix derived from the secret changes
 }
 
-// DefaultPlugin creates a plugin with the default pprof entrypoint and the provided token.
-// It uses the default pprof index route as the entrypoint.
+// DefaultPlugin creates a plugin with the default configuration and the provided token.
+// It uses the default pprof index route as the entrypoint, and panics if the token is empty.
 func DefaultPlugin(token string) *plugin {
-	return Plugin(pprofIndexRoute, token)
+	p, err := Plugin(token)
+	if err != nil {
+		panic(err)
+	}
+	return p
 }
 
-// Plugin creates a new plugin instance with the specified entrypoint and token.
-// It generates a random prefix for securing routes and initializes all routes with the prefix.
-func Plugin(entrypoint, token string) *plugin {
-	prefix := randPrefix()
-	return &plugin{
-		entrypoint:   entrypoint,
-		token:        token,
-		prefix:       prefix,
-		pprofIndex:   prefix + pprofIndexRoute,
-		pprofName:    prefix + pprofNameRoute,
-		pprofCmdline: prefix + pprofCmdlineRoute,
-		pprofProfile: prefix + pprofProfileRoute,
-		pprofSymbol:  prefix + pprofSymbolRoute,
-		pprofTrace:   prefix + pprofTraceRoute,
-		memRoute:     prefix + memRoute,
-		gcRoute:      prefix + gcRoute,
-		traceRoute:   prefix + traceRoute,
+// Plugin creates a new plugin instance with the specified token, configured by the given options.
+// The token is accepted as a bearer token and by the login form, ahead of the authenticators given
+// with WithAuthenticators or WithTokenSource; it may be empty if there are any. Sessions are signed with a key derived
+// from the token, unless WithSessionKey is given, or with a random one without a token.
+// It generates a random prefix for securing routes unless WithPrefix or WithSharedPrefix is given, and returns an
+// error describing the first invalid option. A prefix shared by replicas requires a token or WithSessionKey,
+// since a random key would make every replica reject the sessions issued by the others.
+func Plugin(token string, opts ...Option) (*plugin, error) {
+	p := &plugin{
+		entrypoint:  pprofIndexRoute,
+		prefixParam: defaultPrefixParam,
+		routes: Routes{Pprof: pprofIndexRoute, Mem: memRoute, GC: gcRoute, Trace: traceRoute, Logout: logoutRoute, Share: shareRoute, Audit: auditRoute, Metrics: metricsRoute,
+			RuntimeMetrics: runtimeMetricsRoute, History: historyRoute},
+		redirectStatus: http.StatusSeeOther,
+		sessionTTL:     time.Hour,
+		maxShareTTL:    24 * time.Hour,
+		traceDuration:  10 * time.Second,
+		jsonValues:     map[string]bool{"1": true, "t": true, "true": true},
+		prefix:         randPrefix(),
+		audits:         auditLog{events: make([]AuditEvent, 256)},
+		snapshots:      snapshots{recent: make([]snapshot, 64)},
+		logger:         log.Default(),
+		lockout:        &lockout{threshold: 5, base: time.Second, max: 15 * time.Minute},
+		loginLimit:     newLimiter(Limit{Rate: 10, Burst: 20}),
+		limits: map[Endpoint]*limiter{
+			EndpointProfile:    newLimiter(Limit{Concurrency: 1}),
+			EndpointPprofTrace: newLimiter(Limit{Concurrency: 1}),
+			EndpointTrace:      newLimiter(Limit{Concurrency: 1}),
+		},
+	}
+	if err := WithEndpoints(AllEndpoints...)(p); err != nil {
+		return nil, err
+	}
+	if token != "" {
+		p.authenticators = []Authenticator{BearerToken(token)}
+		key := hmac.New(sha256.New, []byte(token))
+		key.Write([]byte("pprof4svc session key"))
+		p.sessionKey = key.Sum(nil)
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.authenticators) == 0 {
+		return nil, fmt.Errorf("pprof4svc: token must not be empty unless an authenticator is given")
+	}
+	if p.sessionKey == nil {
+		if p.shared {
+			return nil, fmt.Errorf("pprof4svc: a fixed or shared prefix requires a token or WithSessionKey, so that replicas accept each other's sessions")
+		}
+		p.sessionKey = make([]byte, sha256.Size)
+		if _, err := rand.Read(p.sessionKey); err != nil {
+			return nil, err
+		}
+	}
+	if p.maxTraceDuration > 0 && p.traceDuration > p.maxTraceDuration {
+		return nil, fmt.Errorf("pprof4svc: trace duration %s exceeds max trace duration %s", p.traceDuration, p.maxTraceDuration)
+	}
+	if p.history != nil {
+		p.history.start()
+	}
+	for _, a := range p.authenticators {
+		if t, ok := a.(*sourcedToken); ok {
+			t.start()
+		}
 	}
+	return p, nil
 }
 
-// Plug registers the plugin's routes with the provided Gin engine.
-// It sets up handlers for pprof, memory, GC, and trace endpoints, with token-based authentication.
-func (p *plugin) Plug(engine *gin.Engine) {
-	// Define type aliases for handler functions to simplify wrapping
-	type (
-		fn    = http.HandlerFunc       // Standard HTTP handler function
-		fnCtx = func(ctx *gin.Context) // Gin context handler function
-	)
-	// wrapped converts a standard HTTP handler to a Gin handler
-	wrapped := func(f fn) fnCtx {
-		return func(ctx *gin.Context) {
-			f(ctx.Writer, ctx.Request)
+// Close stops the background work of the plugin, i.e. the sampling of the history enabled by WithHistory
+// and the reloads of the tokens of WithTokenSource. The history taken so far is still served, and the current
+// tokens stay valid. Close always returns nil.
+func (p *plugin) Close() error {
+	if p.history != nil {
+		p.history.stop()
+	}
+	for _, a := range p.authenticators {
+		if t, ok := a.(*sourcedToken); ok {
+			t.stop()
 		}
 	}
-	// Register routes with the Gin engine
-	engine.GET(p.entrypoint, p.handler)
-	engine.GET(p.pprofIndex, wrapped(pprof.Index))
-	engine.GET(p.pprofCmdline, wrapped(pprof.Cmdline))
-	engine.GET(p.pprofProfile, wrapped(pprof.Profile))
-	engine.GET(p.pprofSymbol, wrapped(pprof.Symbol))
-	engine.GET(p.pprofTrace, wrapped(pprof.Trace))
-	engine.GET(p.pprofName, pprof0)
-	engine.GET(p.memRoute, mem0)
-	engine.GET(p.gcRoute, gc0)
-	engine.GET(p.traceRoute, trace0)
+	return nil
+}
+
+// ServeHTTP serves the entrypoint and the prefixed routes, and answers 404 to any other request.
+// The plugin is meant to be mounted at the root of a mux; when mounted below a path with http.StripPrefix,
+// the stripped path is kept in the redirect and the session cookie issued by the entrypoint.
+func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := ""
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		base = strings.TrimSuffix(u.Path, r.URL.Path)
+	}
+	p.serve(w, r, base, r.URL.Path)
+}
+
+// Middleware returns a handler that serves the entrypoint and the prefixed routes,
+// and passes any other request on to next, e.g. the application's own mux.
+func (p *plugin) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := p.lookup("", r.URL.Path); h != nil && p.admits(r) {
+			h(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-// handler authenticates requests to the entrypoint using a token query parameter.
-// If the token is valid, it redirects to the pprof index route; otherwise, it returns an unauthorized error.
-func (p *plugin) handler(ctx *gin.Context) {
-	token0, _ := ctx.GetQuery("token")
-	if token0 != p.token {
-		ctx.String(http.StatusUnauthorized, "Unauthorized")
+// serve serves a request whose path, relative to the base path the plugin is mounted on, is path.
+func (p *plugin) serve(w http.ResponseWriter, r *http.Request, base, path string) {
+	if h := p.lookup(base, path); h != nil && p.admits(r) {
+		h(w, r)
 		return
 	}
-	ctx.Redirect(http.StatusMovedPermanently, p.pprofIndex)
+	notFound(w)
+}
+
+// lookup returns the handler for the given path, relative to the base path the plugin is mounted on,
+// or nil if the path is neither the entrypoint nor a route under an accepted prefix.
+// Handlers of prefixed routes authenticate the request and check the scope its endpoint requires before serving it.
+func (p *plugin) lookup(base, path string) http.HandlerFunc {
+	if path == p.entrypoint {
+		return methods(func(w http.ResponseWriter, r *http.Request) {
+			if !admit(w, p.loginLimit) {
+				return
+			}
+			defer p.loginLimit.release()
+			p.login(w, r, base)
+		}, http.MethodGet, http.MethodHead, http.MethodPost)
+	}
+	if route, ok := p.stable(path); ok {
+		return methods(func(w http.ResponseWriter, r *http.Request) {
+			// The stable routes check credentials too, so they share the limit of the entrypoint
+			if !admit(w, p.loginLimit) {
+				return
+			}
+			defer p.loginLimit.release()
+			p.redirect(w, r, base, route)
+		}, http.MethodGet, http.MethodHead, http.MethodPost)
+	}
+	i := strings.IndexByte(strings.TrimPrefix(path, "/"), '/')
+	if i < 0 {
+		return nil
+	}
+	prefix, rest := path[:i+1], path[i+1:]
+	if !p.accepts(prefix) {
+		return nil
+	}
+	if rest == p.routes.Logout {
+		return methods(func(w http.ResponseWriter, r *http.Request) {
+			p.logout(w, r, base, prefix)
+		}, http.MethodGet, http.MethodHead, http.MethodPost)
+	}
+	if rest == p.routes.Share {
+		return methods(p.audited(AuditShare, base, prefix, rest, func(w http.ResponseWriter, r *http.Request) {
+			p.share(w, r, base)
+		}), http.MethodGet, http.MethodPost)
+	}
+	endpoint, h := p.route(rest)
+	if h == nil {
+		return nil
+	}
+	return methods(p.audited(AuditAccess, base, prefix, rest, func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(r, endpoint) {
+			serveError(w, http.StatusForbidden, "Forbidden: missing scope "+string(endpointScopes[endpoint]))
+			return
+		}
+		limit := p.limits[endpoint]
+		if !admit(w, limit) {
+			return
+		}
+		defer limit.release()
+		if !p.useShare(r) {
+			serveError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		h(w, r)
+	}), endpointMethods(endpoint)...)
 }
 
-// randPrefix generates a random string prefix for securing routes.
-// The prefix is 40 characters long, using alphanumeric characters and underscores.
-func randPrefix() string {
-	rand0 := func(len0 int) (str string) {
-		chars := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_"
-		for i := 0; i < len0; i++ {
-			str += fmt.Sprintf("%c", chars[rand.Intn(len(chars))])
+// audited returns a handler authenticating a request to a route below the prefix and serving it with h, which
+// gets the authenticated request. Every request is audited once served, with the status and the size of its
+// response: as an event of the given kind, or as a failed authentication if h was not called.
+func (p *plugin) audited(kind AuditKind, base, prefix, route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, aw := time.Now(), &auditWriter{ResponseWriter: w}
+		r, ok := p.auth(aw, r, base, prefix, route)
+		kind := kind
+		if !ok {
+			kind = AuditAuthFailed
+		}
+		defer func() {
+			p.audit(r, AuditEvent{Time: start, Kind: kind, Route: route, Status: aw.statusOf(), Bytes: aw.bytes})
+		}()
+		if ok {
+			h(aw, r)
 		}
+	}
+}
+
+// endpointMethods returns the methods an endpoint answers; the symbol lookup also takes a POST from go tool pprof.
+func endpointMethods(endpoint Endpoint) []string {
+	if endpoint == EndpointSymbol {
+		return []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	return []string{http.MethodGet, http.MethodHead}
+}
+
+// stable returns the pprof route, relative to the prefix, that a path below the entrypoint stands for,
+// e.g. "/debug/pprof/heap" for "/debug/pprof/heap" with the default entrypoint and routes.
+// Only the names of the pprof routes are taken, so that other paths below the entrypoint, e.g. of the app, are left alone.
+func (p *plugin) stable(path string) (string, bool) {
+	below := strings.TrimSuffix(p.entrypoint, "/") + "/"
+	name := strings.TrimPrefix(path, below)
+	if !strings.HasPrefix(path, below) || !pprofName(name) {
+		return "", false
+	}
+	route := p.routes.Pprof + name
+	if _, h := p.route(route); h == nil {
+		return "", false
+	}
+	return route, true
+}
+
+// redirect redirects an authenticated request to a pprof route below the entrypoint to the prefixed route, with 307
+// so that the method and the body are kept, e.g. for the symbol lookup. It gives the pprof routes a stable URL that
+// clients authenticating every request, like go tool pprof, can use: the prefix is only revealed to those allowed
+// the route. Share links are refused: they are minted for the prefixed route, and verifying one here would consume
+// a single-use link before the redirected request.
+func (p *plugin) redirect(w http.ResponseWriter, r *http.Request, base, route string) {
+	if r.URL.Query().Has(shareSig) {
+		start, aw := time.Now(), &auditWriter{ResponseWriter: w}
+		serveError(aw, http.StatusForbidden, "Forbidden: share links are only valid on the prefixed route")
+		p.audit(r, AuditEvent{Time: start, Kind: AuditAuthFailed, Route: route, Status: aw.statusOf(), Bytes: aw.bytes})
 		return
 	}
-	return "/" + rand0(40)
+	prefix := p.prefixes()[0]
+	p.audited(AuditAccess, base, prefix, route, func(w http.ResponseWriter, r *http.Request) {
+		if endpoint, _ := p.route(route); !allowed(r, endpoint) {
+			serveError(w, http.StatusForbidden, "Forbidden: missing scope "+string(endpointScopes[endpoint]))
+			return
+		}
+		u := &url.URL{Path: base + prefix + route, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+	})(w, r)
+}
+
+// route returns the endpoint for the given route, relative to the prefix, and its handler,
+// or a nil handler if there is no such route or its endpoint is disabled.
+func (p *plugin) route(route string) (Endpoint, http.HandlerFunc) {
+	endpoint, h := p.route0(route)
+	if h == nil || !p.endpoints[endpoint] {
+		return endpoint, nil
+	}
+	return endpoint, h
+}
+
+// route0 returns the endpoint for the given route, relative to the prefix, and its handler,
+// or a nil handler if there is no such route.
+func (p *plugin) route0(route string) (Endpoint, http.HandlerFunc) {
+	switch route {
+	case p.routes.Pprof:
+		return EndpointIndex, p.index
+	case p.routes.Pprof + "cmdline":
+		return EndpointCmdline, pprof.Cmdline
+	case p.routes.Pprof + "profile":
+		return EndpointProfile, p.profile
+	case p.routes.Pprof + "symbol":
+		return EndpointSymbol, pprof.Symbol
+	case p.routes.Pprof + "trace":
+		return EndpointPprofTrace, p.pprofTrace
+	case p.routes.Mem:
+		return EndpointMem, p.mem0
+	case p.routes.GC:
+		return EndpointGC, p.gc0
+	case p.routes.Trace:
+		return EndpointTrace, p.trace0
+	case p.routes.Audit:
+		return EndpointAudit, p.auditLog0
+	case p.routes.Metrics:
+		return EndpointMetrics, p.metrics0
+	case p.routes.RuntimeMetrics:
+		return EndpointRuntimeMetrics, p.runtimeMetrics0
+	case p.routes.History:
+		return EndpointHistory, p.history0
+	}
+	if name := strings.TrimPrefix(route, p.routes.Pprof); name != route && !strings.Contains(name, "/") {
+		return EndpointProfiles, p.pprof0(name)
+	}
+	return "", nil
+}
+
+// methods restricts a handler to the given methods, answering 405 to any other.
+func methods(h http.HandlerFunc, allowed ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range allowed {
+			if r.Method == method {
+				h(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		serveError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
 }
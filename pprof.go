@@ -12,30 +12,73 @@
 package pprof4svc
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"runtime/pprof"
+	"net/http/pprof"
 	"strconv"
-
-	"github.com/gin-gonic/gin"
+	"strings"
+	"time"
 )
 
-func pprof0(ctx *gin.Context) {
-	name := ctx.Param("name")
-	ctx.Writer.Header().Set("X-Content-Type-Options", "nosniff")
-	p := pprof.Lookup(name)
-	if p == nil {
-		serveError(ctx.Writer, http.StatusNotFound, "Unknown profile")
-		return
+// pprof0 serves a named profile like pprof.Handler does: a snapshot, a delta profile over the window given by
+// the "seconds" query parameter, which ends early if the client goes away, and a heap profile after a GC with "gc=1".
+// Forcing a GC changes the state of the runtime, so it requires the runtime:write scope and is audited.
+func (p *plugin) pprof0(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.profileDuration(w, r) {
+			return
+		}
+		if gc, _ := strconv.Atoi(r.FormValue("gc")); name == "heap" && gc > 0 {
+			if principal, _ := PrincipalFromContext(r.Context()); !principal.Allowed(ScopeRuntimeWrite) {
+				serveError(w, http.StatusForbidden, "Forbidden: missing scope "+string(ScopeRuntimeWrite))
+				return
+			}
+			// Audit the request once served, with its status, which tells whether the GC ran
+			start, aw := time.Now(), &auditWriter{ResponseWriter: w}
+			defer func() {
+				p.audit(r, AuditEvent{Time: start, Kind: AuditRuntime, Route: p.routes.Pprof + name, Status: aw.statusOf(), Bytes: aw.bytes})
+			}()
+			w = aw
+		}
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// profile serves the CPU profile like pprof.Profile does, within the maximum profile duration.
+func (p *plugin) profile(w http.ResponseWriter, r *http.Request) {
+	if p.profileDuration(w, r) {
+		pprof.Profile(w, r)
 	}
-	debug, _ := strconv.Atoi(ctx.Request.FormValue("debug"))
-	if debug != 0 {
-		ctx.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	} else {
-		ctx.Writer.Header().Set("Content-Type", "application/octet-stream")
-		ctx.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+}
+
+// pprofTrace serves an execution trace like pprof.Trace does, within the maximum profile duration.
+func (p *plugin) pprofTrace(w http.ResponseWriter, r *http.Request) {
+	if p.profileDuration(w, r) {
+		pprof.Trace(w, r)
 	}
-	p.WriteTo(ctx.Writer, debug)
+}
+
+// profileDuration refuses with 400 a request for a profile, or an execution trace, whose "seconds" query parameter
+// exceeds the maximum profile duration, and reports whether the request may proceed.
+func (p *plugin) profileDuration(w http.ResponseWriter, r *http.Request) bool {
+	seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+	if err != nil || p.maxProfileDuration == 0 || seconds <= p.maxProfileDuration.Seconds() {
+		return true
+	}
+	serveError(w, http.StatusBadRequest, fmt.Sprintf("Profile duration exceeds maximum of %s", p.maxProfileDuration))
+	return false
+}
+
+// writeTimeout refuses with 400 a request for a capture lasting the given duration if the server serving it would
+// time the response out first, like net/http/pprof does for profiles, and reports whether the request may proceed.
+func writeTimeout(w http.ResponseWriter, r *http.Request, what string, dur time.Duration) bool {
+	srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+	if ok && srv.WriteTimeout > 0 && dur >= srv.WriteTimeout {
+		serveError(w, http.StatusBadRequest, what+" duration exceeds server's WriteTimeout")
+		return false
+	}
+	return true
 }
 
 func serveError(w http.ResponseWriter, status int, txt string) {
@@ -45,3 +88,45 @@ func serveError(w http.ResponseWriter, status int, txt string) {
 	w.WriteHeader(status)
 	fmt.Fprintln(w, txt)
 }
+
+// StatsSchemaVersion is the version of the JSON schema of MemStats and GCStats, incremented on incompatible changes.
+const StatsSchemaVersion = 1
+
+// pretty reports whether the "pretty" query parameter of the request selects the formatted JSON values of the memory
+// and GC statistics, e.g. "12.34 MB", instead of the raw ones.
+func pretty(r *http.Request) bool {
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
+}
+
+// json reports whether the "json" query parameter of the request selects JSON output.
+func (p *plugin) json(r *http.Request) bool {
+	return p.jsonValues[strings.ToLower(r.URL.Query().Get("json"))]
+}
+
+// writeText writes a plain text response with the given status.
+func writeText(w http.ResponseWriter, status int, txt string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(txt))
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// notFound answers 404 with the same body Gin uses for unknown routes, so that a wrong prefix
+// cannot be told apart from a route that does not exist.
+func notFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("404 page not found"))
+}
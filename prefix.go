@@ -0,0 +1,144 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements generation, derivation, matching and rotation of the route prefix.
+package pprof4svc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultPrefixParam is the name of the route parameter that captures the prefix of the dispatcher route registered
+// with Gin, unless WithPrefixParam is given. Routes are registered with the parameter instead of the prefix itself,
+// so the prefix can be rotated at runtime.
+const defaultPrefixParam = "prefix"
+
+// prefixChars is the alphabet of the prefix; it has 63 characters, so a byte masked to 6 bits
+// maps onto it uniformly once the value 63 is rejected.
+const prefixChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_"
+
+// makePrefix builds a 40 characters long prefix from the bytes produced by fill.
+func makePrefix(fill func(buf []byte)) string {
+	str := make([]byte, 0, 40)
+	buf := make([]byte, sha256.Size)
+	for len(str) < cap(str) {
+		fill(buf)
+		for _, b := range buf {
+			if b &= 63; int(b) < len(prefixChars) && len(str) < cap(str) {
+				str = append(str, prefixChars[b])
+			}
+		}
+	}
+	return "/" + string(str)
+}
+
+// randPrefix generates a random string prefix for securing routes.
+// The prefix is 40 characters long, using alphanumeric characters and underscores drawn from crypto/rand.
+func randPrefix() string {
+	return makePrefix(func(buf []byte) {
+		if _, err := rand.Read(buf); err != nil {
+			panic("pprof4svc: unable to generate prefix: " + err.Error())
+		}
+	})
+}
+
+// derivePrefix derives the prefix of a time window from a shared secret.
+// The bytes are the HMAC-SHA256 of the window index and a block counter, so every holder of the secret
+// derives the same prefix for the same window.
+func derivePrefix(secret []byte, window int64) string {
+	var block uint64
+	return makePrefix(func(buf []byte) {
+		msg := make([]byte, 16)
+		binary.BigEndian.PutUint64(msg, uint64(window))
+		binary.BigEndian.PutUint64(msg[8:], block)
+		block++
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(msg)
+		copy(buf, mac.Sum(nil))
+	})
+}
+
+// prefixes returns the prefixes currently accepted, the one to redirect to first.
+// With a shared secret, the prefixes of the previous and the next window are accepted too, so that a redirect
+// issued by one replica right before the window ends still works on the replica that serves the next request,
+// and so does one issued by a replica whose clock is slightly ahead.
+func (p *plugin) prefixes() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.secret == nil {
+		return []string{p.prefix}
+	}
+	if p.window <= 0 {
+		return []string{derivePrefix(p.secret, 0)}
+	}
+	window := time.Now().UnixNano() / int64(p.window)
+	return []string{derivePrefix(p.secret, window), derivePrefix(p.secret, window-1), derivePrefix(p.secret, window+1)}
+}
+
+// Rotate replaces the prefix with a new random one and invalidates the sessions issued for the old prefix.
+// Requests to the old prefix get 404 from then on; clients have to go through the entrypoint again.
+// A prefix set with WithPrefix or WithSharedPrefix is shared with other replicas, so Rotate returns an error
+// and leaves it unchanged.
+func (p *plugin) Rotate() error {
+	if p.shared {
+		return fmt.Errorf("pprof4svc: a fixed or shared prefix cannot be rotated")
+	}
+	prefix := randPrefix()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.prefix = prefix
+	return nil
+}
+
+// RotateEvery rotates the prefix every interval in the background until the returned stop function is called.
+// An interval of zero or less rotates nothing, and neither does a fixed or shared prefix, which is logged;
+// the stop function does nothing then.
+func (p *plugin) RotateEvery(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	if p.shared {
+		p.logger.Printf("pprof4svc: not rotating a fixed or shared prefix")
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.Rotate()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// accepts reports whether the given prefix is currently accepted.
+func (p *plugin) accepts(prefix string) bool {
+	for _, prefix0 := range p.prefixes() {
+		if equal(prefix, prefix0) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRandPrefix(t *testing.T) {
+	prefix := randPrefix()
+	if len(prefix) != 41 || prefix[0] != '/' || strings.Trim(prefix[1:], prefixChars) != "" {
+		t.Fatalf("got prefix %q, want a slash and 40 characters of the alphabet", prefix)
+	}
+	if randPrefix() == prefix {
+		t.Error("random prefixes: got the same prefix twice")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	p := DefaultPlugin("token")
+	prefix := p.prefixes()[0]
+	if err := p.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if p.accepts(prefix) || !p.accepts(p.prefixes()[0]) {
+		t.Error("rotated prefix: the old prefix is still accepted, or the new one is not")
+	}
+}
+
+func TestRotateEvery(t *testing.T) {
+	p := DefaultPlugin("token")
+	prefix := p.prefixes()[0]
+	stop := p.RotateEvery(time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for p.accepts(prefix) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	stop()
+	if p.accepts(prefix) {
+		t.Error("prefix not rotated")
+	}
+	// A non-positive interval rotates nothing
+	prefix = p.prefixes()[0]
+	p.RotateEvery(0)()
+	if !p.accepts(prefix) {
+		t.Error("zero interval: prefix rotated")
+	}
+}
+
+func TestDerivePrefix(t *testing.T) {
+	prefix := derivePrefix([]byte("secret"), 42)
+	if len(prefix) != 41 || prefix[0] != '/' || strings.Trim(prefix[1:], prefixChars) != "" {
+		t.Fatalf("got prefix %q, want a slash and 40 characters of the alphabet", prefix)
+	}
+	if prefix0 := derivePrefix([]byte("secret"), 42); prefix0 != prefix {
+		t.Errorf("same secret and window: got prefixes %q and %q", prefix, prefix0)
+	}
+	if derivePrefix([]byte("secret"), 43) == prefix || derivePrefix([]byte("other"), 42) == prefix {
+		t.Error("other window or secret: got the same prefix")
+	}
+}
+
+func TestSharedPrefixWindows(t *testing.T) {
+	p, err := Plugin("token", WithSharedPrefix([]byte("secret"), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := time.Now().UnixNano() / int64(time.Hour)
+	// The window may end between the two calls, which shifts every prefix by one
+	if p.prefixes()[0] != derivePrefix([]byte("secret"), window) {
+		window++
+	}
+	for _, w := range []int64{window - 1, window, window + 1} {
+		if !p.accepts(derivePrefix([]byte("secret"), w)) {
+			t.Errorf("window %+d: prefix not accepted", w-window)
+		}
+	}
+	for _, w := range []int64{window - 2, window + 2} {
+		if p.accepts(derivePrefix([]byte("secret"), w)) {
+			t.Errorf("window %+d: prefix accepted", w-window)
+		}
+	}
+	p, err = Plugin("token", WithSharedPrefix([]byte("secret"), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefixes := p.prefixes(); len(prefixes) != 1 || prefixes[0] != derivePrefix([]byte("secret"), 0) {
+		t.Errorf("zero window: got prefixes %q", prefixes)
+	}
+}
+
+func TestRotateSharedPrefix(t *testing.T) {
+	for _, opt := range []Option{WithPrefix("fixed"), WithSharedPrefix([]byte("secret"), time.Hour)} {
+		p, err := Plugin("token", opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefixes := strings.Join(p.prefixes(), " ")
+		if err := p.Rotate(); err == nil {
+			t.Error("rotating a shared prefix: got no error")
+		}
+		if prefixes0 := strings.Join(p.prefixes(), " "); prefixes0 != prefixes {
+			t.Errorf("rotating a shared prefix: got prefixes %q, want %q", prefixes0, prefixes)
+		}
+	}
+}
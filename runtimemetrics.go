@@ -0,0 +1,231 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the runtime metrics endpoint, reading runtime/metrics without stopping the world.
+package pprof4svc
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"net/url"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// RuntimeMetric is a metric of runtime/metrics, as served by the runtime metrics endpoint.
+type RuntimeMetric struct {
+	Name        string            `json:"name"`                // Name of the metric, e.g. "/gc/heap/allocs:bytes"
+	Description string            `json:"description"`         // Description of the metric
+	Kind        string            `json:"kind"`                // Kind of the value: "uint64", "float64" or "histogram"
+	Unit        string            `json:"unit"`                // Unit of the value, the suffix of the name, e.g. "bytes"
+	Cumulative  bool              `json:"cumulative"`          // Whether the value only ever grows
+	Value       any               `json:"value,omitempty"`     // Value of a uint64 or float64 metric
+	Histogram   *RuntimeHistogram `json:"histogram,omitempty"` // Value of a histogram metric
+}
+
+// RuntimeHistogram is the value of a histogram metric: its non-empty buckets, and quantiles estimated from them.
+type RuntimeHistogram struct {
+	Count     uint64                 `json:"count"`     // Number of samples
+	Buckets   []RuntimeBucket        `json:"buckets"`   // Non-empty buckets, in increasing order
+	Quantiles map[string]MetricFloat `json:"quantiles"` // Upper bounds of the buckets holding the 0.5, 0.9, 0.99 and 1 quantiles
+}
+
+// RuntimeBucket is a bucket of a histogram metric, counting the samples in [Lower, Upper).
+type RuntimeBucket struct {
+	Lower MetricFloat `json:"lower"`
+	Upper MetricFloat `json:"upper"`
+	Count uint64      `json:"count"`
+}
+
+// MetricFloat is a float64 encoded in JSON as a number, or as the string "+Inf" or "-Inf" for the infinite bounds
+// of histogram buckets.
+type MetricFloat float64
+
+// MarshalJSON implements json.Marshaler.
+func (f MetricFloat) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(f), 0) {
+		return []byte(`"` + f.String() + `"`), nil
+	}
+	return []byte(f.String()), nil
+}
+
+// String formats the float, with "+Inf" and "-Inf" for the infinities.
+func (f MetricFloat) String() string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 64)
+}
+
+// quantiles are the quantiles estimated from the buckets of histogram metrics.
+var quantiles = []float64{0.5, 0.9, 0.99, 1}
+
+// runtimeMetrics0 handles HTTP requests to the runtime metrics endpoint. It reads the metrics given by the "name"
+// query parameters, or every supported one, and serves them with their description, kind and unit as text,
+// or as JSON or HTML if the "json" or "format" query parameter selects it.
+func (p *plugin) runtimeMetrics0(w http.ResponseWriter, r *http.Request) {
+	catalog := map[string]metrics.Description{}
+	var descs []metrics.Description
+	for _, desc := range metrics.All() {
+		catalog[desc.Name] = desc
+		descs = append(descs, desc)
+	}
+	if names := r.URL.Query()["name"]; len(names) > 0 {
+		descs = descs[:0]
+		for _, name := range names {
+			desc, ok := catalog[name]
+			if !ok {
+				serveError(w, http.StatusNotFound, "Unknown metric "+name)
+				return
+			}
+			descs = append(descs, desc)
+		}
+	}
+	samples := make([]metrics.Sample, len(descs))
+	for i, desc := range descs {
+		samples[i].Name = desc.Name
+	}
+	metrics.Read(samples)
+	result := make([]RuntimeMetric, len(samples))
+	for i, s := range samples {
+		result[i] = newRuntimeMetric(descs[i], s.Value)
+	}
+
+	switch format := r.URL.Query().Get("format"); {
+	case p.json(r) || format == "json":
+		writeJSON(w, http.StatusOK, result)
+	case format == "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(runtimeMetricsHTML(result))
+	default:
+		writeText(w, http.StatusOK, runtimeMetricsText(result))
+	}
+}
+
+// newRuntimeMetric converts a metric of runtime/metrics, with its description, into a RuntimeMetric.
+func newRuntimeMetric(desc metrics.Description, value metrics.Value) RuntimeMetric {
+	m := RuntimeMetric{Name: desc.Name, Description: desc.Description, Cumulative: desc.Cumulative}
+	if i := strings.LastIndexByte(desc.Name, ':'); i >= 0 {
+		m.Unit = desc.Name[i+1:]
+	}
+	switch value.Kind() {
+	case metrics.KindUint64:
+		m.Kind, m.Value = "uint64", value.Uint64()
+	case metrics.KindFloat64:
+		m.Kind, m.Value = "float64", MetricFloat(value.Float64())
+	case metrics.KindFloat64Histogram:
+		m.Kind, m.Histogram = "histogram", newRuntimeHistogram(value.Float64Histogram())
+	default:
+		m.Kind = "unsupported"
+	}
+	return m
+}
+
+// newRuntimeHistogram converts a histogram metric into a RuntimeHistogram, estimating its quantiles.
+func newRuntimeHistogram(h *metrics.Float64Histogram) *RuntimeHistogram {
+	hist := &RuntimeHistogram{Buckets: []RuntimeBucket{}, Quantiles: map[string]MetricFloat{}}
+	for _, count := range h.Counts {
+		hist.Count += count
+	}
+	var cumulative uint64
+	next := 0
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		bucket := RuntimeBucket{Lower: MetricFloat(h.Buckets[i]), Upper: MetricFloat(h.Buckets[i+1]), Count: count}
+		hist.Buckets = append(hist.Buckets, bucket)
+		cumulative += count
+		// A quantile lies in the first bucket reaching it; report its upper bound, or its lower one if infinite
+		for ; next < len(quantiles) && float64(cumulative) >= quantiles[next]*float64(hist.Count); next++ {
+			bound := bucket.Upper
+			if math.IsInf(float64(bound), 1) {
+				bound = bucket.Lower
+			}
+			hist.Quantiles[strconv.FormatFloat(quantiles[next], 'g', -1, 64)] = bound
+		}
+	}
+	return hist
+}
+
+// quantilesText formats the quantiles of a histogram, in increasing order.
+func quantilesText(hist *RuntimeHistogram) string {
+	var parts []string
+	for _, q := range quantiles {
+		key := strconv.FormatFloat(q, 'g', -1, 64)
+		label := "p" + strconv.FormatFloat(q*100, 'g', -1, 64)
+		if q == 1 {
+			label = "max"
+		}
+		if bound, ok := hist.Quantiles[key]; ok {
+			parts = append(parts, label+"="+bound.String())
+		}
+	}
+	return fmt.Sprintf("count=%d %s", hist.Count, strings.Join(parts, " "))
+}
+
+// runtimeMetricsText formats the runtime metrics into a human-readable string.
+func runtimeMetricsText(result []RuntimeMetric) string {
+	var b strings.Builder
+	for _, m := range result {
+		cumulative := ""
+		if m.Cumulative {
+			cumulative = ", cumulative"
+		}
+		if m.Histogram != nil {
+			fmt.Fprintf(&b, "%s: %s (%s, %s%s)\n", m.Name, quantilesText(m.Histogram), m.Kind, m.Unit, cumulative)
+		} else {
+			fmt.Fprintf(&b, "%s: %v (%s, %s%s)\n", m.Name, m.Value, m.Kind, m.Unit, cumulative)
+		}
+		fmt.Fprintf(&b, "    %s\n", m.Description)
+		if m.Histogram != nil {
+			for _, bucket := range m.Histogram.Buckets {
+				fmt.Fprintf(&b, "    [%s, %s): %d\n", bucket.Lower, bucket.Upper, bucket.Count)
+			}
+		}
+	}
+	return b.String()
+}
+
+// runtimeMetricsHTML renders the runtime metrics as an HTML table, with the buckets of histograms in a list.
+func runtimeMetricsHTML(result []RuntimeMetric) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<html>
+<head>
+<title>Runtime metrics</title>
+</head>
+<body>
+<table>
+<thead><td>Name</td><td>Kind</td><td>Unit</td><td>Value</td><td>Description</td></thead>
+`)
+	for _, m := range result {
+		value := fmt.Sprint(m.Value)
+		if m.Histogram != nil {
+			value = quantilesText(m.Histogram)
+		}
+		link := "?format=html&name=" + url.QueryEscape(m.Name)
+		fmt.Fprintf(&b, "<tr><td><a href='%s'>%s</a></td><td>%s</td><td>%s</td><td>%s", html.EscapeString(link),
+			html.EscapeString(m.Name), html.EscapeString(m.Kind), html.EscapeString(m.Unit), html.EscapeString(value))
+		if m.Histogram != nil && len(m.Histogram.Buckets) > 0 {
+			b.WriteString("<ul>")
+			for _, bucket := range m.Histogram.Buckets {
+				fmt.Fprintf(&b, "<li>[%s, %s): %d</li>", bucket.Lower, bucket.Upper, bucket.Count)
+			}
+			b.WriteString("</ul>")
+		}
+		fmt.Fprintf(&b, "</td><td>%s</td></tr>\n", html.EscapeString(m.Description))
+	}
+	b.WriteString("</table>\n</body>\n</html>")
+	return b.Bytes()
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements scopes, the scoped and expiring tokens granting them, and the scope required by each endpoint.
+package pprof4svc
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrExpiredCredential is returned by the built-in authenticators for a credential that has expired.
+var ErrExpiredCredential = errors.New("pprof4svc: expired credential")
+
+// Scope is a permission granted to a principal.
+type Scope string
+
+// Scopes checked by the plugin.
+const (
+	ScopeStatsRead    Scope = "stats:read"    // Read the index, the memory and GC statistics and the metrics
+	ScopeProfileRead  Scope = "profile:read"  // Read named profiles, e.g. heap, goroutine, and look up symbols
+	ScopeProfileCPU   Scope = "profile:cpu"   // Capture CPU profiles
+	ScopeCmdlineRead  Scope = "cmdline:read"  // Read the command line, which may contain secrets passed as flags
+	ScopeTrace        Scope = "trace"         // Capture execution traces
+	ScopeRuntimeWrite Scope = "runtime:write" // Change the state of the runtime
+	ScopeAuditRead    Scope = "audit:read"    // Read the recent audit events
+)
+
+// endpointScopes holds the scope required by each endpoint. An endpoint missing from it
+// is only served to unrestricted principals.
+var endpointScopes = map[Endpoint]Scope{
+	EndpointIndex:          ScopeStatsRead,
+	EndpointProfiles:       ScopeProfileRead,
+	EndpointCmdline:        ScopeCmdlineRead,
+	EndpointProfile:        ScopeProfileCPU,
+	EndpointSymbol:         ScopeProfileRead,
+	EndpointPprofTrace:     ScopeTrace,
+	EndpointMem:            ScopeStatsRead,
+	EndpointGC:             ScopeStatsRead,
+	EndpointTrace:          ScopeTrace,
+	EndpointAudit:          ScopeAuditRead,
+	EndpointMetrics:        ScopeStatsRead,
+	EndpointRuntimeMetrics: ScopeStatsRead,
+	EndpointHistory:        ScopeStatsRead,
+}
+
+// Allowed reports whether the principal is granted the given scope.
+// A principal with nil Scopes is unrestricted and granted every scope.
+func (p *Principal) Allowed(scope Scope) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, scope0 := range p.Scopes {
+		if scope0 == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the principal of a request may access the given endpoint.
+func allowed(r *http.Request, endpoint Endpoint) bool {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return false
+	}
+	scope, ok := endpointScopes[endpoint]
+	if !ok {
+		return principal.Scopes == nil
+	}
+	return principal.Allowed(scope)
+}
+
+// Token is a bearer token granting a set of scopes until it expires.
+type Token struct {
+	Name    string    // Name of the token, which names its principal
+	Secret  string    // Value of the token, sent in an "Authorization: Bearer" header or as a Basic password
+	Expires time.Time // Time the token expires at; it never does if zero
+	Scopes  []Scope   // Scopes granted by the token
+}
+
+// ScopedTokens returns an Authenticator accepting the given tokens in an "Authorization: Bearer" header,
+// or as a Basic password, until they expire. The principal is named after the token and granted its scopes only.
+func ScopedTokens(tokens ...Token) Authenticator {
+	return scopedTokens(append([]Token(nil), tokens...))
+}
+
+// scopedTokens is the Authenticator returned by ScopedTokens.
+type scopedTokens []Token
+
+// Authenticate implements Authenticator.
+func (t scopedTokens) Authenticate(r *http.Request) (*Principal, error) {
+	secret, ok := bearer(r)
+	if !ok {
+		return nil, nil
+	}
+	secrets := make([]string, len(t))
+	for i := range t {
+		secrets[i] = t[i].Secret
+	}
+	i := match(secret, secrets)
+	if i < 0 {
+		return nil, ErrInvalidCredential
+	}
+	token := &t[i]
+	if !token.Expires.IsZero() && !time.Now().Before(token.Expires) {
+		return nil, ErrExpiredCredential
+	}
+	return &Principal{Name: token.Name, Scopes: append([]Scope{}, token.Scopes...), Expires: token.Expires}, nil
+}
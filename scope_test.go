@@ -0,0 +1,160 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		credential string
+		tokens     []string
+		want       int
+	}{
+		{"b", []string{"a", "b", "c"}, 1},
+		{"d", []string{"a", "b", "c"}, -1},
+		{"", []string{"a", "", "c"}, -1},
+		{"a", nil, -1},
+		{"ab", []string{"a", "abc"}, -1},
+	}
+	for _, test := range tests {
+		if got := match(test.credential, test.tokens); got != test.want {
+			t.Errorf("match(%q, %q): got %d, want %d", test.credential, test.tokens, got, test.want)
+		}
+	}
+}
+
+func TestTokenAuthenticators(t *testing.T) {
+	named := NamedTokens(map[string]string{"ci": "ci-token", "ops": "ops-token", "empty": ""})
+	scoped := ScopedTokens(
+		Token{Name: "ci", Secret: "ci-token", Scopes: []Scope{ScopeStatsRead}},
+		Token{Name: "old", Secret: "old-token", Expires: time.Now().Add(-time.Minute)},
+		Token{Name: "empty"},
+	)
+	tests := []struct {
+		name          string
+		authenticator Authenticator
+		token         string
+		want          string // Name of the principal, or empty if the token is rejected
+		wantErr       error
+	}{
+		{"named token", named, "ops-token", "ops", nil},
+		{"other named token", named, "ci-token", "ci", nil},
+		{"wrong named token", named, "wrong", "", ErrInvalidCredential},
+		{"empty named token", named, "", "", ErrInvalidCredential},
+		{"scoped token", scoped, "ci-token", "ci", nil},
+		{"expired scoped token", scoped, "old-token", "", ErrExpiredCredential},
+		{"wrong scoped token", scoped, "wrong", "", ErrInvalidCredential},
+		{"empty scoped token", scoped, "", "", ErrInvalidCredential},
+	}
+	for _, test := range tests {
+		principal, err := test.authenticator.Authenticate(tokenRequest(test.token))
+		name := ""
+		if principal != nil {
+			name = principal.Name
+		}
+		if name != test.want || !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got principal %q and error %v, want %q and %v", test.name, name, err, test.want, test.wantErr)
+		}
+	}
+	if principal, _ := scoped.Authenticate(tokenRequest("ci-token")); principal == nil || len(principal.Scopes) != 1 || principal.Scopes[0] != ScopeStatsRead {
+		t.Errorf("scoped token: got %+v, want the scopes of the token", principal)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	stats := &Principal{Name: "stats", Scopes: []Scope{ScopeStatsRead}}
+	tests := []struct {
+		name      string
+		principal *Principal
+		endpoint  Endpoint
+		want      bool
+	}{
+		{"no principal", nil, EndpointMem, false},
+		{"unrestricted", &Principal{Name: "token"}, EndpointProfile, true},
+		{"unrestricted, endpoint without a scope", &Principal{Name: "token"}, Endpoint("other"), true},
+		{"granted scope", stats, EndpointMem, true},
+		{"other endpoint of the scope", stats, EndpointHistory, true},
+		{"missing scope", stats, EndpointProfile, false},
+		{"restricted, endpoint without a scope", stats, Endpoint("other"), false},
+		{"no scopes at all", &Principal{Name: "none", Scopes: []Scope{}}, EndpointMem, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, pprofIndexRoute, nil)
+		if test.principal != nil {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, test.principal))
+		}
+		if got := allowed(r, test.endpoint); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIndexFiltering(t *testing.T) {
+	tokens := ScopedTokens(
+		Token{Name: "stats", Secret: "stats-token", Scopes: []Scope{ScopeStatsRead}},
+		Token{Name: "profiles", Secret: "profiles-token", Scopes: []Scope{ScopeStatsRead, ScopeProfileRead, ScopeTrace}},
+	)
+	tests := []struct {
+		name    string
+		opts    []Option
+		token   string
+		links   []string // Links the index has
+		noLinks []string // Links the index does not have
+	}{
+		{"unrestricted", nil, "token",
+			[]string{"'heap?debug=1'", "'cmdline?debug=1'", "'profile?debug=1'", "/debug/mem'", "/debug/trace'", "/debug/audit'"},
+			[]string{"/debug/history'"}},
+		{"statistics only", nil, "stats-token",
+			[]string{"/debug/mem'", "/debug/gc'", "/debug/metrics'"},
+			[]string{"'heap?debug=1'", "goroutine?debug=2", "'cmdline?debug=1'", "'profile?debug=1'", "/debug/trace'", "/debug/audit'"}},
+		{"profiles and traces", nil, "profiles-token",
+			[]string{"'heap?debug=1'", "goroutine?debug=2", "'symbol?debug=1'", "'trace?debug=1'", "/debug/trace'"},
+			[]string{"'cmdline?debug=1'", "'profile?debug=1'", "/debug/audit'"}},
+		{"safe endpoints", []Option{WithEndpoints(SafeEndpoints...)}, "token",
+			[]string{"/debug/mem'", "/debug/metrics'"},
+			[]string{"'heap?debug=1'", "'cmdline?debug=1'", "'profile?debug=1'", "/debug/trace'", "/debug/audit'"}},
+		{"history", []Option{WithHistory(time.Hour, 10)}, "token", []string{"/debug/history'"}, nil},
+	}
+	for _, test := range tests {
+		p, err := Plugin("token", append([]Option{WithAuthenticators(tokens)}, test.opts...)...)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		r := httptest.NewRequest(http.MethodGet, p.prefixes()[0]+p.routes.Pprof, nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		p.Close()
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", test.name, w.Code, http.StatusOK)
+		}
+		body := w.Body.String()
+		for _, link := range test.links {
+			if !strings.Contains(body, link) {
+				t.Errorf("%s: got no link %s", test.name, link)
+			}
+		}
+		for _, link := range test.noLinks {
+			if strings.Contains(body, link) {
+				t.Errorf("%s: got link %s, want none", test.name, link)
+			}
+		}
+	}
+}
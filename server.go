@@ -0,0 +1,193 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the standalone admin listener serving the plugin apart from the public one.
+package pprof4svc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// ServerConfig configures the standalone listener started by ListenAndServe.
+type ServerConfig struct {
+	Network string // Network to listen on, "tcp" (default) or "unix"
+	Addr    string // Address to listen on, e.g. "127.0.0.1:6060", or the path of the Unix socket
+
+	SocketMode  os.FileMode // Permissions of the Unix socket, 0600 if zero
+	SocketUser  string      // Owner of the Unix socket, by name or numeric ID; unchanged if empty
+	SocketGroup string      // Group of the Unix socket, by name or numeric ID; unchanged if empty
+
+	TLSConfig *tls.Config // TLS configuration; TLS is enabled if it is set or CertFile is
+	CertFile  string      // Certificate file for TLS
+	KeyFile   string      // Private key file for TLS
+
+	ClientCAs  *x509.CertPool     // CAs verifying client certificates, which are requested if it is set, for ClientCert; requires TLS
+	ClientAuth tls.ClientAuthType // Policy for client certificates if ClientCAs is set, tls.VerifyClientCertIfGiven if zero
+
+	ReadHeaderTimeout time.Duration // Time allowed to read request headers, 10s if zero
+	ReadTimeout       time.Duration // Time allowed to read a request, unlimited if zero
+	WriteTimeout      time.Duration // Time allowed to write a response, unlimited if zero; captures longer than it are refused
+	IdleTimeout       time.Duration // Time a keep-alive connection may stay idle, unlimited if zero
+	ShutdownTimeout   time.Duration // Time in-flight requests get to complete on shutdown, 5s if zero
+}
+
+// ListenAndServe serves the plugin on its own listener, configured by cfg, until ctx is done.
+// It then shuts the server down gracefully, letting in-flight requests complete within the shutdown timeout;
+// the contexts of those still running when it expires are canceled, so that traces, profiles and deltas end early,
+// before the server is closed.
+// It returns nil after a graceful shutdown, or the error that stopped the server.
+// ClientCAs requires TLS, enabled by TLSConfig or CertFile; without it, ListenAndServe returns an error.
+func (p *plugin) ListenAndServe(ctx context.Context, cfg ServerConfig) error {
+	if cfg.ClientCAs != nil && cfg.TLSConfig == nil && cfg.CertFile == "" {
+		return fmt.Errorf("pprof4svc: client CAs require TLS, set TLSConfig or CertFile")
+	}
+	ln, err := listen(cfg)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	tlsConfig := cfg.TLSConfig
+	if cfg.ClientCAs != nil {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		tlsConfig.ClientCAs, tlsConfig.ClientAuth = cfg.ClientCAs, cfg.ClientAuth
+		if tlsConfig.ClientAuth == tls.NoClientCert {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	// Cancel the requests still in flight when the shutdown times out, so that captures waiting out their duration end
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	srv := &http.Server{
+		Handler:           p,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if srv.ReadHeaderTimeout == 0 {
+		srv.ReadHeaderTimeout = 10 * time.Second
+	}
+	// Serve in the background, so that the shutdown can be driven by ctx
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.TLSConfig != nil || cfg.CertFile != "" {
+			errc <- srv.ServeTLS(ln, cfg.CertFile, cfg.KeyFile)
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+	select {
+	case err = <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	timeout := cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		cancelBase()
+		srv.Close()
+		return err
+	}
+	if err = <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listen opens the listener described by cfg, applying the mode and owner of a Unix socket.
+// A stale Unix socket at the path is replaced, but listen fails if a process still answers on it.
+func listen(cfg ServerConfig) (net.Listener, error) {
+	switch cfg.Network {
+	case "":
+		return net.Listen("tcp", cfg.Addr)
+	case "tcp", "tcp4", "tcp6":
+		return net.Listen(cfg.Network, cfg.Addr)
+	case "unix":
+	default:
+		return nil, fmt.Errorf("pprof4svc: unsupported network %q", cfg.Network)
+	}
+	// Remove a socket left behind by a previous process, but nothing else, and not one another process listens on
+	if fi, err := os.Lstat(cfg.Addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.DialTimeout("unix", cfg.Addr, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("pprof4svc: socket %q is in use by another process", cfg.Addr)
+		}
+		os.Remove(cfg.Addr)
+	}
+	ln, err := net.Listen("unix", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	mode := cfg.SocketMode
+	if mode == 0 {
+		mode = 0o600
+	}
+	if err = os.Chmod(cfg.Addr, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if cfg.SocketUser != "" || cfg.SocketGroup != "" {
+		if err = chown(cfg.Addr, cfg.SocketUser, cfg.SocketGroup); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// chown changes the owner and group of a file, given by name or numeric ID; empty ones are left unchanged.
+func chown(path, owner, group string) error {
+	uid, gid := -1, -1
+	if owner != "" {
+		id := owner
+		if u, err := user.Lookup(owner); err == nil {
+			id = u.Uid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("pprof4svc: unknown socket user %q", owner)
+		}
+		uid = n
+	}
+	if group != "" {
+		id := group
+		if g, err := user.LookupGroup(group); err == nil {
+			id = g.Gid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("pprof4svc: unknown socket group %q", group)
+		}
+		gid = n
+	}
+	return os.Chown(path, uid, gid)
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startServer runs ListenAndServe in the background until the returned stop function is called, which returns
+// its error. It waits for the server to accept connections.
+func startServer(t *testing.T, p *plugin, cfg ServerConfig) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- p.ListenAndServe(ctx, cfg) }()
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+	for i := 0; ; i++ {
+		conn, err := net.Dial(network, cfg.Addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-errc:
+			cancel()
+			t.Fatalf("ListenAndServe: %v", err)
+		default:
+		}
+		if i == 50 {
+			cancel()
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() error {
+		cancel()
+		return <-errc
+	}
+}
+
+// freeAddr returns a local TCP address nothing listens on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// unixClient returns a client connecting to the Unix socket at path whatever the URL.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// getMem requests the memory statistics of the plugin with the token from the server at host.
+func getMem(t *testing.T, client *http.Client, host string, p *plugin) int {
+	r, err := http.NewRequest(http.MethodGet, "http://"+host+p.prefixes()[0]+p.routes.Mem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer token")
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestListenAndServeTCP(t *testing.T) {
+	p := DefaultPlugin("token")
+	addr := freeAddr(t)
+	stop := startServer(t, p, ServerConfig{Addr: addr})
+	if status := getMem(t, http.DefaultClient, addr, p); status != http.StatusOK {
+		t.Errorf("memory statistics: got status %d, want %d", status, http.StatusOK)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("shutdown: got %v, want nil", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("after shutdown: got a connection, want none")
+	}
+}
+
+func TestListenAndServeUnix(t *testing.T) {
+	p := DefaultPlugin("token")
+	path := filepath.Join(t.TempDir(), "pprof.sock")
+	stop := startServer(t, p, ServerConfig{
+		Network:     "unix",
+		Addr:        path,
+		SocketMode:  0o660,
+		SocketUser:  strconv.Itoa(os.Getuid()),
+		SocketGroup: strconv.Itoa(os.Getgid()),
+	})
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0o660 {
+		t.Errorf("socket: got mode %s, want a socket with 0660", fi.Mode())
+	}
+	if status := getMem(t, unixClient(path), "pprof", p); status != http.StatusOK {
+		t.Errorf("memory statistics: got status %d, want %d", status, http.StatusOK)
+	}
+
+	// A second server refuses to replace the live socket
+	if err := p.ListenAndServe(context.Background(), ServerConfig{Network: "unix", Addr: path}); err == nil {
+		t.Error("live socket: got no error")
+	}
+	if status := getMem(t, unixClient(path), "pprof", p); status != http.StatusOK {
+		t.Errorf("after a refused server: got status %d, want %d", status, http.StatusOK)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("shutdown: got %v, want nil", err)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+
+	// A socket nothing listens on any more is replaced, with the default mode
+	stale := filepath.Join(dir, "stale.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = listen(ServerConfig{Network: "unix", Addr: stale})
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	if fi, err := os.Stat(stale); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("stale socket: got %v, %v, want mode 0600", fi, err)
+	}
+	ln.Close()
+
+	// Any other file is left alone
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := listen(ServerConfig{Network: "unix", Addr: file}); err == nil {
+		ln.Close()
+		t.Error("regular file: got no error")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "data" {
+		t.Errorf("regular file: got %q, %v, want it unchanged", data, err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  ServerConfig
+	}{
+		{"unknown network", ServerConfig{Network: "udp", Addr: filepath.Join(dir, "udp")}},
+		{"unknown user", ServerConfig{Network: "unix", Addr: filepath.Join(dir, "user.sock"), SocketUser: "no such user"}},
+		{"unknown group", ServerConfig{Network: "unix", Addr: filepath.Join(dir, "group.sock"), SocketGroup: "no such group"}},
+	}
+	for _, test := range tests {
+		if ln, err := listen(test.cfg); err == nil {
+			ln.Close()
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
+
+// startTrace requests a trace of the given duration from the server at addr in the background, and waits
+// until it runs. The returned channel receives the length of the trace, or -1 if it failed.
+func startTrace(t *testing.T, p *plugin, addr string, dur time.Duration) <-chan int {
+	done := make(chan int, 1)
+	go func() {
+		r, _ := http.NewRequest(http.MethodGet, "http://"+addr+p.prefixes()[0]+p.routes.Trace+"?dur="+dur.String(), nil)
+		r.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			done <- -1
+			return
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			done <- -1
+			return
+		}
+		done <- len(data)
+	}()
+	for i := 0; !trace.IsEnabled(); i++ {
+		if i == 100 {
+			t.Fatal("trace: not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return done
+}
+
+func TestShutdownCompletesCapture(t *testing.T) {
+	p := DefaultPlugin("token")
+	addr := freeAddr(t)
+	stop := startServer(t, p, ServerConfig{Addr: addr, ShutdownTimeout: 5 * time.Second})
+	done := startTrace(t, p, addr, 300*time.Millisecond)
+	start := time.Now()
+	if err := stop(); err != nil {
+		t.Errorf("shutdown: got %v, want nil", err)
+	}
+	if n := <-done; n <= 0 {
+		t.Errorf("trace: got %d bytes, want a complete trace", n)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("shutdown: took %s, want it to wait for the trace", elapsed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	p := DefaultPlugin("token")
+	addr := freeAddr(t)
+	stop := startServer(t, p, ServerConfig{Addr: addr, ShutdownTimeout: 100 * time.Millisecond})
+	done := startTrace(t, p, addr, time.Minute)
+	start := time.Now()
+	if err := stop(); err == nil {
+		t.Error("shutdown: got no error, want the timeout")
+	}
+	<-done
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("shutdown: took %s, want the trace canceled", elapsed)
+	}
+	// The canceled trace is stopped
+	for i := 0; trace.IsEnabled(); i++ {
+		if i == 100 {
+			t.Fatal("trace: still running after the shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientCertWithoutTLS(t *testing.T) {
+	err := certPlugin(t).ListenAndServe(context.Background(), ServerConfig{Addr: "127.0.0.1:0", ClientCAs: newTestCA(t).pool})
+	if err == nil {
+		t.Fatal("ListenAndServe with client CAs and without TLS: got no error")
+	}
+}
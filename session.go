@@ -0,0 +1,239 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the login flow and the signed, expiring session cookies it issues.
+package pprof4svc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionCookie is the name of the cookie carrying the session issued by the login.
+const sessionCookie = "pprof4svc_session"
+
+// loginPage is the HTML form posting the credential to the entrypoint; %s is replaced by an error message.
+// The user name is only needed for HTTP Basic credentials.
+const loginPage = `<html>
+<head>
+<title>pprof4svc</title>
+</head>
+<body>
+<form method="post">
+<p>%s</p>
+<label>User <input type="text" name="username" autocomplete="username"></label>
+<label>Token <input type="password" name="token" autocomplete="current-password" autofocus></label>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>`
+
+// expiringSet is a set of keys, each forgotten once it expires, e.g. the sessions revoked by a logout.
+type expiringSet struct {
+	mu   sync.Mutex
+	keys map[string]time.Time // Keys and the time they expire at
+}
+
+// add adds a key until it expires, and forgets the keys that have expired since.
+// It reports false if the key was already in the set.
+func (s *expiringSet) add(key string, expires time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = map[string]time.Time{}
+	}
+	now := time.Now()
+	for key0, expires0 := range s.keys {
+		if expires0.Before(now) {
+			delete(s.keys, key0)
+		}
+	}
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+	s.keys[key] = expires
+	return true
+}
+
+// has reports whether a key is in the set.
+func (s *expiringSet) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[key]
+	return ok
+}
+
+// sign returns the signature of a session payload for the given prefix. Sessions end with the prefix
+// they were issued for; with a key shared by every replica, each of them accepts the sessions issued by the others.
+func (p *plugin) sign(prefix, payload string) string {
+	mac := hmac.New(sha256.New, p.sessionKey)
+	mac.Write([]byte(prefix + "\n" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newSession returns a session of the given principal for the given prefix, expiring at the given time.
+// The payload holds the name and scopes of the principal, "*" standing for nil scopes, and the expiry.
+func (p *plugin) newSession(prefix string, principal *Principal, expires time.Time) string {
+	scopes := "*"
+	if principal.Scopes != nil {
+		scopes0 := make([]string, len(principal.Scopes))
+		for i, scope := range principal.Scopes {
+			scopes0[i] = string(scope)
+		}
+		scopes = strings.Join(scopes0, " ")
+	}
+	payload := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(principal.Name)),
+		base64.RawURLEncoding.EncodeToString([]byte(scopes)),
+		strconv.FormatInt(expires.Unix(), 10),
+	}, ".")
+	return payload + "." + p.sign(prefix, payload)
+}
+
+// parseSession verifies a session for the given prefix and returns its principal and expiry.
+// It reports false if the session is malformed, forged, expired or revoked.
+func (p *plugin) parseSession(prefix, session string) (*Principal, time.Time, bool) {
+	i := strings.LastIndexByte(session, '.')
+	if i < 0 || !equal(session[i+1:], p.sign(prefix, session[:i])) {
+		return nil, time.Time{}, false
+	}
+	fields := strings.Split(session[:i], ".")
+	if len(fields) != 3 {
+		return nil, time.Time{}, false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(fields[0])
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	scopes, err := base64.RawURLEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	expires := time.Unix(unix, 0)
+	if !time.Now().Before(expires) || p.revoked.has(session) {
+		return nil, time.Time{}, false
+	}
+	principal := &Principal{Name: string(name), Expires: expires}
+	if string(scopes) != "*" {
+		principal.Scopes = []Scope{}
+		for _, scope := range strings.Fields(string(scopes)) {
+			principal.Scopes = append(principal.Scopes, Scope(scope))
+		}
+	}
+	return principal, expires, true
+}
+
+// setSession issues the session cookie, scoped to the path of the prefix so it is never sent elsewhere.
+// A zero expiry deletes the cookie.
+func setSession(w http.ResponseWriter, r *http.Request, path, session string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session,
+		Path:     path,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if expires.IsZero() {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// login serves the entrypoint. GET renders the login form; POST authenticates the credential it submits,
+// as a bearer token or, with a user name, as HTTP Basic credentials, or else the request itself, e.g. by its
+// client certificate. If an authenticator accepts it, login issues a session cookie and redirects to the
+// pprof index route under the base path the plugin is mounted on. No response is cacheable,
+// and the credential never appears in a URL.
+func (p *plugin) login(w http.ResponseWriter, r *http.Request, base string) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		p.loginPage(w, http.StatusOK, "")
+		return
+	}
+	start, client := time.Now(), p.client(r)
+	event := AuditEvent{Time: start, Kind: AuditLoginFailed, Principal: r.PostFormValue("username"), Route: p.entrypoint}
+	if retry, locked := p.lockout.locked(client); locked {
+		retryAfter(w, retry)
+		p.loginPage(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+		event.Status = http.StatusTooManyRequests
+		p.audit(r, event)
+		return
+	}
+	r0 := r
+	if token := r.PostFormValue("token"); token != "" {
+		r0 = r.Clone(r.Context())
+		if user := r.PostFormValue("username"); user != "" {
+			r0.SetBasicAuth(user, token)
+		} else {
+			r0.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	principal, err := p.authenticate(r0)
+	if err != nil || principal == nil {
+		p.lockout.fail(client)
+		p.loginPage(w, http.StatusUnauthorized, "Invalid credentials")
+		event.Status = http.StatusUnauthorized
+		p.audit(r, event)
+		return
+	}
+	p.lockout.succeed(client)
+	// The session ends with the credential it was issued for, if that expires first
+	prefix := p.prefixes()[0]
+	expires := time.Now().Add(p.sessionTTL)
+	if !principal.Expires.IsZero() && principal.Expires.Before(expires) {
+		expires = principal.Expires
+	}
+	setSession(w, r, base+prefix, p.newSession(prefix, principal, expires), expires)
+	http.Redirect(w, r, base+prefix+p.routes.Pprof, p.redirectStatus)
+	event.Kind, event.Principal, event.Status = AuditLogin, principal.Name, p.redirectStatus
+	p.audit(r, event)
+}
+
+// loginPage renders the login form with the given status and error message.
+func (p *plugin) loginPage(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	w.Write([]byte(strings.Replace(loginPage, "%s", html.EscapeString(msg), 1)))
+}
+
+// logout revokes the session of the request, deletes its cookie and redirects to the entrypoint.
+func (p *plugin) logout(w http.ResponseWriter, r *http.Request, base, prefix string) {
+	start := time.Now()
+	var principal *Principal
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		var expires time.Time
+		if principal, expires, _ = p.parseSession(prefix, cookie.Value); principal != nil {
+			p.revoked.add(cookie.Value, expires)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	setSession(w, r, base+prefix, "", time.Time{})
+	http.Redirect(w, r, base+p.entrypoint, http.StatusSeeOther)
+	if principal != nil {
+		p.audit(r, AuditEvent{Time: start, Kind: AuditLogout, Principal: principal.Name, Route: p.routes.Logout, Status: http.StatusSeeOther})
+	}
+}
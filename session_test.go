@@ -0,0 +1,137 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSession(t *testing.T) {
+	p := DefaultPlugin("token")
+	prefix := p.prefixes()[0]
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	session := p.newSession(prefix, &Principal{Name: "ops", Scopes: []Scope{ScopeStatsRead}}, expires)
+	principal, expires0, ok := p.parseSession(prefix, session)
+	if !ok || principal.Name != "ops" || len(principal.Scopes) != 1 || principal.Scopes[0] != ScopeStatsRead || !expires0.Equal(expires) {
+		t.Fatalf("valid session: got %+v, %s, %v", principal, expires0, ok)
+	}
+	unrestricted := p.newSession(prefix, &Principal{Name: "token"}, expires)
+	if principal, _, ok := p.parseSession(prefix, unrestricted); !ok || principal.Scopes != nil {
+		t.Errorf("unrestricted session: got %+v, %v, want nil scopes", principal, ok)
+	}
+
+	fields := strings.Split(session, ".")
+	other := DefaultPlugin("other token")
+	tests := []struct {
+		name    string
+		p       *plugin
+		prefix  string
+		session string
+	}{
+		{"tampered name", p, prefix, strings.Join([]string{"YWRtaW4", fields[1], fields[2], fields[3]}, ".")},
+		{"tampered scopes", p, prefix, strings.Join([]string{fields[0], "Kg", fields[2], fields[3]}, ".")},
+		{"tampered expiry", p, prefix, strings.Join([]string{fields[0], fields[1], "9999999999", fields[3]}, ".")},
+		{"tampered signature", p, prefix, session[:len(session)-2] + "AA"},
+		{"missing signature", p, prefix, strings.Join(fields[:3], ".")},
+		{"malformed", p, prefix, "session"},
+		{"other prefix", p, "/other", session},
+		{"other key", other, prefix, session},
+		{"expired", p, prefix, p.newSession(prefix, &Principal{Name: "ops"}, time.Now().Add(-time.Second))},
+	}
+	for _, test := range tests {
+		if principal, _, ok := test.p.parseSession(test.prefix, test.session); ok || principal != nil {
+			t.Errorf("%s: got %+v, %v, want a rejection", test.name, principal, ok)
+		}
+	}
+
+	p.revoked.add(session, expires)
+	if principal, _, ok := p.parseSession(prefix, session); ok || principal != nil {
+		t.Errorf("revoked session: got %+v, %v, want a rejection", principal, ok)
+	}
+}
+
+func TestLoginSession(t *testing.T) {
+	p := DefaultPlugin("token")
+	r := httptest.NewRequest(http.MethodPost, pprofIndexRoute, strings.NewReader(url.Values{"token": {"token"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("login: got status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Path != p.prefixes()[0] {
+		t.Fatalf("login: got cookies %v", cookies)
+	}
+	r = httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("index with session: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestSharedPrefixRequiresSessionKey(t *testing.T) {
+	basic := WithAuthenticators(BasicAuth(map[string]string{"ops": "secret"}))
+	if _, err := Plugin("", basic, WithSharedPrefix([]byte("secret"), time.Hour)); err == nil {
+		t.Error("shared prefix with a random session key: got no error")
+	}
+	if _, err := Plugin("", basic, WithPrefix("fixed")); err == nil {
+		t.Error("fixed prefix with a random session key: got no error")
+	}
+	if _, err := Plugin("", basic, WithPrefix("fixed"), WithSessionKey([]byte("0123456789abcdef"))); err != nil {
+		t.Errorf("fixed prefix with a session key: %v", err)
+	}
+	if _, err := Plugin("token", WithSharedPrefix([]byte("secret"), time.Hour)); err != nil {
+		t.Errorf("shared prefix with a token: %v", err)
+	}
+}
+
+func TestStaleSession(t *testing.T) {
+	// A session of another replica, or of a previous process, is deleted and does not lock the client out
+	p, err := Plugin("", WithAuthenticators(BasicAuth(map[string]string{"ops": "secret"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Plugin("", WithAuthenticators(BasicAuth(map[string]string{"ops": "secret"})), WithPrefix(p.prefixes()[0]),
+		WithSessionKey([]byte("0123456789abcdef")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := p.prefixes()[0]
+	session := other.newSession(prefix, &Principal{Name: "ops"}, time.Now().Add(time.Hour))
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest(http.MethodGet, prefix+pprofIndexRoute, nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d with a stale session: got status %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Fatalf("request %d with a stale session: got cookies %v, want it deleted", i, cookies)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, prefix+pprofIndexRoute, nil)
+	r.SetBasicAuth("ops", "secret")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Basic credentials after stale sessions: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
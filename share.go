@@ -0,0 +1,180 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements signed, time-limited share links to a single route of the pprof service.
+package pprof4svc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters added to the route and parameters of a share link; all of them are signed.
+const (
+	shareExpires = "share_exp"   // Unix time the link expires at
+	shareNonce   = "share_nonce" // Random value identifying the link
+	shareOnce    = "share_once"  // Present if the link can be used only once
+	shareBy      = "share_by"    // Name of the principal who minted the link
+	shareSig     = "share_sig"   // Signature of the route and all other parameters
+)
+
+// ShareLink mints a link to the given route, relative to the prefix, with the given query parameters.
+// The link authenticates the request it is used for, only for that route and exactly those parameters,
+// until the TTL elapses, and only once if once is set. It grants only the scope the route requires.
+// The link is relative to the base path the plugin is mounted on, and stops working when the prefix rotates.
+func (p *plugin) ShareLink(route string, params url.Values, ttl time.Duration, once bool) (string, error) {
+	return p.shareLink("", route, params, ttl, once)
+}
+
+// shareLink mints a share link on behalf of the named principal, if any.
+func (p *plugin) shareLink(by, route string, params url.Values, ttl time.Duration, once bool) (string, error) {
+	if _, h := p.route(route); h == nil {
+		return "", fmt.Errorf("pprof4svc: no route %q to share", route)
+	}
+	if ttl <= 0 || ttl > p.maxShareTTL {
+		return "", fmt.Errorf("pprof4svc: share TTL %s must be positive and at most %s", ttl, p.maxShareTTL)
+	}
+	query := url.Values{}
+	for key, values := range params {
+		if strings.HasPrefix(key, "share_") {
+			return "", fmt.Errorf("pprof4svc: parameter %q is reserved for share links", key)
+		}
+		query[key] = append([]string(nil), values...)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	query.Set(shareExpires, strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	query.Set(shareNonce, base64.RawURLEncoding.EncodeToString(nonce))
+	if once {
+		query.Set(shareOnce, "1")
+	}
+	if by != "" {
+		query.Set(shareBy, by)
+	}
+	query.Set(shareSig, p.signShare(route, query))
+	return p.prefixes()[0] + route + "?" + query.Encode(), nil
+}
+
+// signShare returns the signature of a share link to the given route, covering every parameter but the signature.
+func (p *plugin) signShare(route string, query url.Values) string {
+	query0 := url.Values{}
+	for key, values := range query {
+		if key != shareSig {
+			query0[key] = values
+		}
+	}
+	mac := hmac.New(sha256.New, p.sessionKey)
+	mac.Write([]byte("share\n" + route + "?" + query0.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyShare verifies the share link a request to the given route was made with, and returns a principal
+// granted only the scope of the route, expiring with the link. A single-use link is refused once used,
+// but only useShare marks it used.
+func (p *plugin) verifyShare(route string, query url.Values) (*Principal, error) {
+	if !equal(query.Get(shareSig), p.signShare(route, query)) {
+		return nil, ErrInvalidCredential
+	}
+	unix, err := strconv.ParseInt(query.Get(shareExpires), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	expires := time.Unix(unix, 0)
+	if !time.Now().Before(expires) {
+		return nil, ErrExpiredCredential
+	}
+	if query.Has(shareOnce) && p.usedLinks.has(query.Get(shareNonce)) {
+		return nil, errors.New("pprof4svc: share link already used")
+	}
+	endpoint, _ := p.route0(route)
+	principal := &Principal{Name: "share", Scopes: []Scope{}, Expires: expires}
+	if by := query.Get(shareBy); by != "" {
+		principal.Name += ":" + by
+	}
+	if scope, ok := endpointScopes[endpoint]; ok {
+		principal.Scopes = append(principal.Scopes, scope)
+	}
+	return principal, nil
+}
+
+// useShare marks the single-use share link an authenticated request was made with as used, right before the request
+// is served, so that a request refused before, e.g. by the limit of its endpoint, leaves the link usable.
+// It reports false if another request used the link meanwhile; requests made otherwise are always served.
+func (p *plugin) useShare(r *http.Request) bool {
+	query := r.URL.Query()
+	if !query.Has(shareSig) || !query.Has(shareOnce) {
+		return true
+	}
+	principal, _ := PrincipalFromContext(r.Context())
+	return p.usedLinks.add(query.Get(shareNonce), principal.Expires)
+}
+
+// share serves the share endpoint, which mints a share link for the authenticated principal.
+// The "route" parameter names the route to share, "ttl" the lifetime of the link (15m by default)
+// and "once" makes it single-use; every other parameter is passed on to the shared route.
+// A principal can only share the routes it is allowed itself, and no longer than its credential is valid.
+func (p *plugin) share(w http.ResponseWriter, r *http.Request, base string) {
+	if err := r.ParseForm(); err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params := url.Values{}
+	for key, values := range r.Form {
+		params[key] = values
+	}
+	route := params.Get("route")
+	ttl := 15 * time.Minute
+	if ttl0 := params.Get("ttl"); ttl0 != "" {
+		var err error
+		if ttl, err = time.ParseDuration(ttl0); err != nil {
+			serveError(w, http.StatusBadRequest, "Invalid ttl")
+			return
+		}
+	}
+	once, _ := strconv.ParseBool(params.Get("once"))
+	delete(params, "route")
+	delete(params, "ttl")
+	delete(params, "once")
+	principal, _ := PrincipalFromContext(r.Context())
+	if endpoint, _ := p.route0(route); !principal.Allowed(endpointScopes[endpoint]) {
+		serveError(w, http.StatusForbidden, "Forbidden: missing scope "+string(endpointScopes[endpoint]))
+		return
+	}
+	// The link ends with the credential of its creator, if that expires first, like a session does
+	expires := time.Now().Add(ttl)
+	if !principal.Expires.IsZero() && principal.Expires.Before(expires) {
+		expires = principal.Expires
+		ttl = time.Until(expires)
+	}
+	link, err := p.shareLink(principal.Name, route, params, ttl, once)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":     base + link,
+		"expires": expires.Format(time.RFC3339),
+		"once":    once,
+	})
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shareQuery mints a share link to the route and returns its query.
+func shareQuery(t *testing.T, p *plugin, route string, params url.Values, ttl time.Duration, once bool) url.Values {
+	t.Helper()
+	link, err := p.ShareLink(route, params, ttl, once)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
+
+func TestVerifyShare(t *testing.T) {
+	p := DefaultPlugin("token")
+	route := p.routes.Pprof + "heap"
+	query := shareQuery(t, p, route, url.Values{"debug": {"1"}}, time.Minute, false)
+	principal, err := p.verifyShare(route, query)
+	if err != nil || !principal.Allowed(ScopeProfileRead) || principal.Allowed(ScopeProfileCPU) {
+		t.Fatalf("valid link: got %+v, %v, want a principal allowed %s only", principal, err, ScopeProfileRead)
+	}
+
+	// expired signs a copy of the query expiring in the past
+	expired := url.Values{}
+	for key, values := range query {
+		expired[key] = values
+	}
+	expired.Set(shareExpires, strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+	expired.Set(shareSig, p.signShare(route, expired))
+	tests := []struct {
+		name  string
+		route string
+		edit  func(query url.Values)
+	}{
+		{"other route", p.routes.Pprof + "goroutine", nil},
+		{"tampered parameter", route, func(query url.Values) { query.Set("debug", "2") }},
+		{"added parameter", route, func(query url.Values) { query.Set("gc", "1") }},
+		{"tampered expiry", route, func(query url.Values) { query.Set(shareExpires, "9999999999") }},
+		{"tampered signature", route, func(query url.Values) { query.Set(shareSig, query.Get(shareSig)[1:]) }},
+		{"missing signature", route, func(query url.Values) { query.Del(shareSig) }},
+		{"expired", route, func(query url.Values) {
+			for key := range query {
+				query[key] = expired[key]
+			}
+		}},
+	}
+	for _, test := range tests {
+		query0 := url.Values{}
+		for key, values := range query {
+			query0[key] = append([]string(nil), values...)
+		}
+		if test.edit != nil {
+			test.edit(query0)
+		}
+		if principal, err := p.verifyShare(test.route, query0); err == nil || principal != nil {
+			t.Errorf("%s: got %+v, %v, want a rejection", test.name, principal, err)
+		}
+	}
+
+	if principal, err := DefaultPlugin("other token").verifyShare(route, query); err == nil || principal != nil {
+		t.Errorf("other key: got %+v, %v, want a rejection", principal, err)
+	}
+}
+
+func TestShareOnce(t *testing.T) {
+	p := DefaultPlugin("token")
+	link, err := p.ShareLink(p.routes.Mem, nil, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Verifying the link does not use it up; serving a request with it does
+	u, _ := url.Parse(link)
+	for i := 0; i < 2; i++ {
+		if _, err := p.verifyShare(p.routes.Mem, u.Query()); err != nil {
+			t.Fatalf("verification %d: %v", i, err)
+		}
+	}
+	for i, status := range []int{http.StatusOK, http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+		if w.Code != status {
+			t.Errorf("use %d: got status %d, want %d", i, w.Code, status)
+		}
+	}
+}
+
+func TestShareOnceLimited(t *testing.T) {
+	// A single-use link refused by the limit of its endpoint stays usable
+	p, err := Plugin("token", WithLimit(EndpointMem, Limit{Concurrency: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := p.ShareLink(p.routes.Mem, nil, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := p.limits[EndpointMem]
+	if _, ok := limit.acquire(); !ok {
+		t.Fatal("limit refused the first request")
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("use while the endpoint is busy: got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	limit.release()
+	for i, status := range []int{http.StatusOK, http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+		if w.Code != status {
+			t.Errorf("use %d once the endpoint is free: got status %d, want %d", i, w.Code, status)
+		}
+	}
+}
+
+func TestShareTTLClampedToCredential(t *testing.T) {
+	expires := time.Now().Add(time.Minute)
+	p, err := Plugin("", WithAuthenticators(ScopedTokens(Token{
+		Name: "oncall", Secret: "secret", Expires: expires, Scopes: []Scope{ScopeStatsRead},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, p.prefixes()[0]+p.routes.Share+"?route="+p.routes.Mem+"&ttl=24h", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("share: got status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		URL     string `json:"url"`
+		Expires string `json:"expires"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(resp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix, _ := strconv.ParseInt(u.Query().Get(shareExpires), 10, 64)
+	if time.Unix(unix, 0).After(expires) {
+		t.Errorf("link expires at %s, after the token at %s", time.Unix(unix, 0), expires)
+	}
+	if expires0, err := time.Parse(time.RFC3339, resp.Expires); err != nil || expires0.After(expires) {
+		t.Errorf("reported expiry %q, after the token at %s", resp.Expires, expires)
+	}
+}
+
+func TestShareLinkStableRoute(t *testing.T) {
+	// A single-use link sent to the stable URL is refused there, and stays usable on the prefixed route
+	p := DefaultPlugin("token")
+	route := p.routes.Pprof + "heap"
+	link, err := p.ShareLink(route, nil, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, p.prefixes()[0]), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("stable URL: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("prefixed URL: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the snapshots of the memory and GC statistics, and the deltas between two of them.
+package pprof4svc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotHeader is the response header carrying the ID of the snapshot served by the memory and GC statistics endpoints.
+const snapshotHeader = "X-Snapshot-Id"
+
+// StatsDelta is the response of the memory and GC statistics endpoints in diff mode: the change of every numeric field
+// of runtime.MemStats or debug.GCStats between two snapshots. Durations are in nanoseconds and sizes in bytes.
+type StatsDelta struct {
+	SchemaVersion int          `json:"schema_version"` // Version of the schema, StatsSchemaVersion
+	From          string       `json:"from"`           // ID of the earlier snapshot
+	To            string       `json:"to"`             // ID of the later snapshot
+	FromTime      time.Time    `json:"from_time"`      // Time the earlier snapshot was taken at
+	ToTime        time.Time    `json:"to_time"`        // Time the later snapshot was taken at
+	Seconds       float64      `json:"seconds"`        // Time elapsed between the snapshots
+	Fields        []FieldDelta `json:"fields"`         // Changes of the numeric fields, in declaration order
+}
+
+// FieldDelta is the change of a numeric field of runtime.MemStats or debug.GCStats between two snapshots.
+type FieldDelta struct {
+	Name      string   `json:"name"`                 // Name of the field, e.g. "TotalAlloc"
+	Before    float64  `json:"before"`               // Value in the earlier snapshot
+	After     float64  `json:"after"`                // Value in the later snapshot
+	Delta     float64  `json:"delta"`                // After minus before
+	PerSecond *float64 `json:"per_second,omitempty"` // Delta per second elapsed between the snapshots, for cumulative counters only
+}
+
+// cumulativeFields holds the fields of runtime.MemStats and debug.GCStats that only grow, whose delta has a rate.
+// The other numeric fields are gauges, e.g. HeapAlloc, or timestamps and targets, e.g. LastGC and NextGC.
+var cumulativeFields = map[string]bool{
+	"TotalAlloc":   true,
+	"Lookups":      true,
+	"Mallocs":      true,
+	"Frees":        true,
+	"PauseTotalNs": true,
+	"NumGC":        true,
+	"NumForcedGC":  true,
+	"PauseTotal":   true,
+}
+
+// snapshot is a reading of the memory or GC statistics.
+type snapshot struct {
+	id    string    // ID of the snapshot, prefixed with its kind, e.g. "mem-12"
+	time  time.Time // Time the statistics were read at
+	stats any       // *runtime.MemStats or *debug.GCStats
+}
+
+// snapshots keeps the most recent snapshots in a ring buffer, for the "since" query parameter.
+type snapshots struct {
+	mu     sync.Mutex
+	seq    uint64     // Sequence number of the last snapshot
+	recent []snapshot // Ring buffer of the snapshots
+	next   int        // Index the next snapshot is written to
+}
+
+// take reads the statistics of the given kind, "mem" or "gc", and keeps them as a new snapshot,
+// overwriting the oldest one if the buffer is full.
+func (s *snapshots) take(kind string) snapshot {
+	snap := snapshot{time: time.Now()}
+	if kind == "mem" {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		snap.stats = &ms
+	} else {
+		var gs debug.GCStats
+		debug.ReadGCStats(&gs)
+		snap.stats = &gs
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	snap.id = kind + "-" + strconv.FormatUint(s.seq, 10)
+	if len(s.recent) > 0 {
+		s.recent[s.next] = snap
+		s.next = (s.next + 1) % len(s.recent)
+	}
+	return snap
+}
+
+// get returns the snapshot with the given ID, if it is still kept.
+func (s *snapshots) get(id string) (snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, snap := range s.recent {
+		if snap.id == id && id != "" {
+			return snap, true
+		}
+	}
+	return snapshot{}, false
+}
+
+// statsDelta serves the delta between two snapshots of the given kind if the "delta" or "since" query parameter
+// asks for it, and reports whether it did. With "delta", a duration, it takes a snapshot, waits for the duration
+// and takes another; with "since", the ID of a kept snapshot, it compares that snapshot with a new one.
+func (p *plugin) statsDelta(w http.ResponseWriter, r *http.Request, kind, title string) bool {
+	query := r.URL.Query()
+	delta, since := query.Get("delta"), query.Get("since")
+	if delta == "" && since == "" {
+		return false
+	}
+	if delta != "" && since != "" {
+		serveError(w, http.StatusBadRequest, "Use either delta or since, not both")
+		return true
+	}
+	var from snapshot
+	if since != "" {
+		var ok bool
+		if from, ok = p.snapshots.get(since); !ok || !strings.HasPrefix(since, kind+"-") {
+			serveError(w, http.StatusNotFound, "Unknown snapshot "+since)
+			return true
+		}
+	} else {
+		dur, err := time.ParseDuration(delta)
+		if err != nil || dur <= 0 {
+			serveError(w, http.StatusBadRequest, "Invalid delta "+delta)
+			return true
+		}
+		if p.maxProfileDuration > 0 && dur > p.maxProfileDuration {
+			serveError(w, http.StatusBadRequest, fmt.Sprintf("Delta duration exceeds maximum of %s", p.maxProfileDuration))
+			return true
+		}
+		if !writeTimeout(w, r, "Delta", dur) {
+			return true
+		}
+		from = p.snapshots.take(kind)
+		timer := time.NewTimer(dur)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			// The client went away; there is nobody to answer
+			return true
+		}
+	}
+	to := p.snapshots.take(kind)
+	d := newStatsDelta(from, to)
+	w.Header().Set(snapshotHeader, to.id)
+	if p.json(r) {
+		writeJSON(w, http.StatusOK, d)
+		return true
+	}
+	writeText(w, http.StatusOK, statsDeltaText(title, d))
+	return true
+}
+
+// newStatsDelta computes the change of every numeric field of the statistics between two snapshots of the same kind.
+func newStatsDelta(from, to snapshot) StatsDelta {
+	d := StatsDelta{
+		SchemaVersion: StatsSchemaVersion,
+		From:          from.id,
+		To:            to.id,
+		FromTime:      from.time,
+		ToTime:        to.time,
+		Seconds:       to.time.Sub(from.time).Seconds(),
+		Fields:        []FieldDelta{},
+	}
+	before, after := reflect.ValueOf(from.stats).Elem(), reflect.ValueOf(to.stats).Elem()
+	for i := 0; i < before.NumField(); i++ {
+		b, ok := numeric(before.Field(i))
+		if !ok {
+			continue
+		}
+		a, _ := numeric(after.Field(i))
+		field := FieldDelta{Name: before.Type().Field(i).Name, Before: b, After: a, Delta: a - b}
+		if d.Seconds > 0 && cumulativeFields[field.Name] {
+			perSecond := field.Delta / d.Seconds
+			field.PerSecond = &perSecond
+		}
+		d.Fields = append(d.Fields, field)
+	}
+	return d
+}
+
+// numeric returns the value of an integer or floating-point field, e.g. a time.Duration, as a float64.
+// It reports false for any other field, such as arrays, slices, booleans and times.
+func numeric(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// statsDeltaText formats a delta between two snapshots into a human-readable table.
+func statsDeltaText(title string, d StatsDelta) string {
+	var b strings.Builder
+	header := fmt.Sprintf("=========================== Go Runtime %s Statistics Delta ===========================\n", title)
+	b.WriteString(header)
+	fmt.Fprintf(&b, "From:        %s (%s)\n", d.From, d.FromTime.Format("2006-01-02 15:04:05.000"))
+	fmt.Fprintf(&b, "To:          %s (%s)\n", d.To, d.ToTime.Format("2006-01-02 15:04:05.000"))
+	fmt.Fprintf(&b, "Elapsed:     %.3f s\n", d.Seconds)
+	fmt.Fprintf(&b, "%-16s %20s %20s %20s %20s\n", "Field", "Before", "After", "Delta", "Per second")
+	for _, f := range d.Fields {
+		perSecond := "-"
+		if f.PerSecond != nil {
+			perSecond = strconv.FormatFloat(*f.PerSecond, 'f', 2, 64)
+		}
+		fmt.Fprintf(&b, "%-16s %20s %20s %20s %20s\n", f.Name, strconv.FormatFloat(f.Before, 'f', -1, 64),
+			strconv.FormatFloat(f.After, 'f', -1, 64), strconv.FormatFloat(f.Delta, 'f', -1, 64), perSecond)
+	}
+	b.WriteString(header)
+	return b.String()
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getStats requests a route of the plugin with the token, and returns the response.
+func getStats(ctx context.Context, p *plugin, route string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, p.prefixes()[0]+route, nil).WithContext(ctx)
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	return w
+}
+
+func TestStatsDelta(t *testing.T) {
+	p := DefaultPlugin("token")
+	ctx := context.Background()
+	mem := getStats(ctx, p, p.routes.Mem).Header().Get(snapshotHeader)
+	gc := getStats(ctx, p, p.routes.GC).Header().Get(snapshotHeader)
+	if !strings.HasPrefix(mem, "mem-") || !strings.HasPrefix(gc, "gc-") {
+		t.Fatalf("snapshots: got IDs %q and %q", mem, gc)
+	}
+	tests := []struct {
+		name   string
+		route  string
+		status int
+		from   string // ID of the earlier snapshot of the delta, if any
+	}{
+		{"since a memory snapshot", p.routes.Mem + "?json=true&since=" + mem, http.StatusOK, mem},
+		{"since a GC snapshot", p.routes.GC + "?json=true&since=" + gc, http.StatusOK, gc},
+		{"delta", p.routes.Mem + "?json=true&delta=10ms", http.StatusOK, ""},
+		{"unknown snapshot", p.routes.Mem + "?since=mem-999999", http.StatusNotFound, ""},
+		{"empty delta and since", p.routes.Mem + "?since=&delta=", http.StatusOK, ""},
+		{"snapshot of the other kind", p.routes.Mem + "?since=" + gc, http.StatusNotFound, ""},
+		{"other snapshot of the other kind", p.routes.GC + "?since=" + mem, http.StatusNotFound, ""},
+		{"both delta and since", p.routes.Mem + "?delta=1s&since=" + mem, http.StatusBadRequest, ""},
+		{"invalid delta", p.routes.Mem + "?delta=soon", http.StatusBadRequest, ""},
+		{"negative delta", p.routes.Mem + "?delta=-1s", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		w := getStats(ctx, p, test.route)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+			continue
+		}
+		if test.status != http.StatusOK || !strings.Contains(test.route, "json=true") {
+			continue
+		}
+		var d StatsDelta
+		if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if (test.from != "" && d.From != test.from) || d.To != w.Header().Get(snapshotHeader) || len(d.Fields) == 0 || d.Seconds <= 0 {
+			t.Errorf("%s: got a delta from %q to %q over %gs with %d fields", test.name, d.From, d.To, d.Seconds, len(d.Fields))
+		}
+		// Only the cumulative counters have a rate
+		for _, f := range d.Fields {
+			if (f.PerSecond != nil) != cumulativeFields[f.Name] {
+				t.Errorf("%s: got rate %v for %s", test.name, f.PerSecond, f.Name)
+			}
+			if f.Delta != f.After-f.Before {
+				t.Errorf("%s: got delta %g for %s from %g to %g", test.name, f.Delta, f.Name, f.Before, f.After)
+			}
+		}
+	}
+
+	// A delta the server would cut off is refused
+	ctx = context.WithValue(ctx, http.ServerContextKey, &http.Server{WriteTimeout: time.Second})
+	if w := getStats(ctx, p, p.routes.Mem+"?delta=2s"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "WriteTimeout") {
+		t.Errorf("delta beyond the WriteTimeout: got status %d and body %q, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+	if w := getStats(ctx, p, p.routes.Mem+"?delta=10ms"); w.Code != http.StatusOK {
+		t.Errorf("delta within the WriteTimeout: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestStatsDeltaRates(t *testing.T) {
+	from := snapshot{id: "mem-1", time: time.Unix(100, 0), stats: &runtime.MemStats{TotalAlloc: 1000, NumGC: 3, HeapAlloc: 500, LastGC: 10, NextGC: 4000}}
+	to := snapshot{id: "mem-2", time: time.Unix(102, 0), stats: &runtime.MemStats{TotalAlloc: 3000, NumGC: 7, HeapAlloc: 300, LastGC: 2e9, NextGC: 8000}}
+	d := newStatsDelta(from, to)
+	tests := map[string]struct {
+		delta     float64
+		perSecond float64 // Rate of the field, or -1 if it has none
+	}{
+		"TotalAlloc": {2000, 1000},
+		"NumGC":      {4, 2},
+		"HeapAlloc":  {-200, -1},
+		"LastGC":     {2e9 - 10, -1},
+		"NextGC":     {4000, -1},
+	}
+	for _, f := range d.Fields {
+		test, ok := tests[f.Name]
+		if !ok {
+			continue
+		}
+		delete(tests, f.Name)
+		perSecond := -1.0
+		if f.PerSecond != nil {
+			perSecond = *f.PerSecond
+		}
+		if f.Delta != test.delta || perSecond != test.perSecond {
+			t.Errorf("%s: got delta %g and rate %g, want %g and %g", f.Name, f.Delta, perSecond, test.delta, test.perSecond)
+		}
+	}
+	for name := range tests {
+		t.Errorf("%s: got no field", name)
+	}
+	if text := statsDeltaText("Memory", d); !strings.Contains(text, "1000.00") {
+		t.Errorf("text: got %q, want the rate of TotalAlloc", text)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof4svc provides functionality for exposing Go runtime statistics and tracing via HTTP endpoints.
+// This file implements the token sources, and the reloading of the token they provide.
+package pprof4svc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource provides the token accepted by the plugin, which may change over time.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenFunc is a TokenSource calling a function, e.g. to fetch the token from a secret manager.
+type TokenFunc func() (string, error)
+
+// Token calls f().
+func (f TokenFunc) Token() (string, error) {
+	return f()
+}
+
+// String describes the source in the log.
+func (f TokenFunc) String() string {
+	return "func"
+}
+
+// StaticToken returns a TokenSource providing the given token.
+func StaticToken(token string) TokenSource {
+	return staticToken(token)
+}
+
+// staticToken is the TokenSource returned by StaticToken.
+type staticToken string
+
+// Token implements TokenSource.
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// String describes the source in the log, without revealing the token.
+func (t staticToken) String() string {
+	return "literal"
+}
+
+// EnvToken returns a TokenSource providing the value of the given environment variable.
+func EnvToken(name string) TokenSource {
+	return envToken(name)
+}
+
+// envToken is the TokenSource returned by EnvToken.
+type envToken string
+
+// Token implements TokenSource.
+func (e envToken) Token() (string, error) {
+	token, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", string(e))
+	}
+	return token, nil
+}
+
+// String describes the source in the log.
+func (e envToken) String() string {
+	return "env " + string(e)
+}
+
+// FileToken returns a TokenSource providing the content of the given file, without surrounding whitespace,
+// e.g. a Kubernetes secret mounted as a file.
+func FileToken(path string) TokenSource {
+	return fileToken(path)
+}
+
+// fileToken is the TokenSource returned by FileToken.
+type fileToken string
+
+// Token implements TokenSource.
+func (f fileToken) Token() (string, error) {
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// String describes the source in the log.
+func (f fileToken) String() string {
+	return "file " + string(f)
+}
+
+// minReload is the shortest interval between two reloads forced by a token that does not match, so that clients
+// sending wrong tokens cannot hammer the source.
+const minReload = time.Second
+
+// sourcedToken is an Authenticator accepting the token of a source in an "Authorization: Bearer" header,
+// or as a Basic password, reloaded from the source every reload interval in the background. A replaced token
+// stays valid for the grace period. The principal is named "token".
+type sourcedToken struct {
+	source   TokenSource
+	reload   time.Duration                 // Interval between reloads, none if zero
+	grace    time.Duration                 // Time a replaced token stays valid
+	logf     func(format string, v ...any) // Logs the reloads
+	mu       sync.Mutex
+	token    string               // Current token
+	loaded   time.Time            // Time the token was last loaded at
+	previous map[string]time.Time // Replaced tokens and the time they stop being valid
+	done     chan struct{}        // Closed to stop the reloads
+	once     sync.Once            // Guards the closing of done
+}
+
+// start reloads the token every reload interval in the background, until stop is called. It does nothing
+// if the reload interval is zero.
+func (t *sourcedToken) start() {
+	if t.reload <= 0 {
+		return
+	}
+	ticker := time.NewTicker(t.reload)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.mu.Lock()
+				if err := t.load(); err != nil {
+					t.logf("%v; keeping the current token", err)
+				}
+				t.mu.Unlock()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the reloads; the current token stays valid.
+func (t *sourcedToken) stop() {
+	t.once.Do(func() { close(t.done) })
+}
+
+// load loads the token from the source, keeping the current one if it fails. It must be called with mu held.
+func (t *sourcedToken) load() error {
+	now := time.Now()
+	t.loaded = now
+	token, err := t.source.Token()
+	if err == nil && token == "" {
+		err = errors.New("empty token")
+	}
+	if err != nil {
+		return fmt.Errorf("pprof4svc: loading token from %v: %w", t.source, err)
+	}
+	for token0, expires := range t.previous {
+		if !now.Before(expires) {
+			delete(t.previous, token0)
+		}
+	}
+	if token == t.token {
+		return nil
+	}
+	if t.token != "" {
+		if t.grace > 0 {
+			t.previous[t.token] = now.Add(t.grace)
+		}
+		t.logf("pprof4svc: token reloaded from %v; the previous one stays valid for %s", t.source, t.grace)
+	}
+	delete(t.previous, token)
+	t.token = token
+	return nil
+}
+
+// tokens returns the valid tokens, reloading them first if force is set, the token is reloaded at all,
+// and the last load is at least minReload old.
+func (t *sourcedToken) tokens(force bool) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if force && t.reload > 0 && time.Since(t.loaded) >= minReload {
+		if err := t.load(); err != nil {
+			t.logf("%v; keeping the current token", err)
+		}
+	}
+	now := time.Now()
+	tokens := []string{t.token}
+	for token, expires := range t.previous {
+		if now.Before(expires) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Authenticate implements Authenticator.
+func (t *sourcedToken) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearer(r)
+	if !ok {
+		return nil, nil
+	}
+	// A client may already send a token the source was just rotated to, e.g. a replaced Kubernetes secret:
+	// reload it before rejecting the client, rather than counting it toward the lockout until the next reload
+	if match(token, t.tokens(false)) < 0 && match(token, t.tokens(true)) < 0 {
+		return nil, ErrInvalidCredential
+	}
+	return &Principal{Name: "token"}, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2025 pprof4svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof4svc
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenRequest returns a request carrying the token as a bearer token.
+func tokenRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, pprofIndexRoute, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// countingSource is a TokenSource counting its loads.
+type countingSource struct {
+	mu    sync.Mutex
+	token string
+	loads int
+}
+
+// Token implements TokenSource.
+func (s *countingSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	return s.token, nil
+}
+
+// set replaces the token provided by the source.
+func (s *countingSource) set(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// newSourcedToken returns the authenticator of WithTokenSource, with the token loaded.
+func newSourcedToken(t *testing.T, source TokenSource, reload, grace time.Duration) *sourcedToken {
+	p := &plugin{logger: log.New(io.Discard, "", 0)}
+	if err := WithTokenSource(source, reload, grace)(p); err != nil {
+		t.Fatal(err)
+	}
+	return p.authenticators[0].(*sourcedToken)
+}
+
+func TestTokenReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("one\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Plugin("", WithTokenSource(FileToken(path), 10*time.Millisecond, time.Hour), WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	authenticate := func(token string) bool {
+		principal, err := p.authenticators[0].Authenticate(tokenRequest(token))
+		return err == nil && principal != nil
+	}
+	if !authenticate("one") {
+		t.Fatal("initial token: rejected")
+	}
+
+	// The file is reloaded in the background, without any request
+	if err := os.WriteFile(path, []byte("two\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t0 := p.authenticators[0].(*sourcedToken)
+	for i := 0; ; i++ {
+		t0.mu.Lock()
+		token := t0.token
+		t0.mu.Unlock()
+		if token == "two" {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("reload: got token %q, want %q", token, "two")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !authenticate("two") || !authenticate("one") {
+		t.Error("after the reload: want the new token and, within the grace period, the replaced one accepted")
+	}
+
+	// A failed reload keeps the current token
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !authenticate("two") {
+		t.Error("failed reload: current token rejected")
+	}
+
+	// Close stops the reloads
+	p.Close()
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("three\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	t0.mu.Lock()
+	token := t0.token
+	t0.mu.Unlock()
+	if token != "two" {
+		t.Errorf("after Close: got token %q, want %q", token, "two")
+	}
+}
+
+func TestTokenGrace(t *testing.T) {
+	source := &countingSource{token: "one"}
+	t0 := newSourcedToken(t, source, time.Hour, 50*time.Millisecond)
+	source.set("two")
+	t0.mu.Lock()
+	t0.load()
+	t0.mu.Unlock()
+	if tokens := t0.tokens(false); len(tokens) != 2 {
+		t.Errorf("within the grace period: got tokens %v, want two", tokens)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if tokens := t0.tokens(false); len(tokens) != 1 || tokens[0] != "two" {
+		t.Errorf("after the grace period: got tokens %v, want [two]", tokens)
+	}
+
+	// Without a grace period, a replaced token is rejected right away
+	source = &countingSource{token: "one"}
+	t0 = newSourcedToken(t, source, time.Hour, 0)
+	source.set("two")
+	t0.mu.Lock()
+	t0.load()
+	t0.mu.Unlock()
+	if tokens := t0.tokens(false); len(tokens) != 1 || tokens[0] != "two" {
+		t.Errorf("without a grace period: got tokens %v, want [two]", tokens)
+	}
+}
+
+func TestTokenForcedReload(t *testing.T) {
+	source := &countingSource{token: "one"}
+	t0 := newSourcedToken(t, source, time.Hour, time.Hour)
+	source.set("two")
+
+	// A token that does not match forces a reload once the last load is minReload old
+	if _, err := t0.Authenticate(tokenRequest("two")); err == nil {
+		t.Error("forced reload right after a load: want the new token rejected")
+	}
+	t0.mu.Lock()
+	t0.loaded = time.Now().Add(-minReload)
+	t0.mu.Unlock()
+	if principal, err := t0.Authenticate(tokenRequest("two")); err != nil || principal == nil {
+		t.Errorf("forced reload: got %v, %v, want the new token accepted", principal, err)
+	}
+	if source.loads != 2 {
+		t.Errorf("forced reload: got %d loads, want 2", source.loads)
+	}
+
+	// Wrong tokens do not reload again within minReload
+	for i := 0; i < 10; i++ {
+		if _, err := t0.Authenticate(tokenRequest("wrong")); !errors.Is(err, ErrInvalidCredential) {
+			t.Errorf("wrong token: got %v, want %v", err, ErrInvalidCredential)
+		}
+	}
+	if source.loads != 2 {
+		t.Errorf("wrong tokens: got %d loads, want 2", source.loads)
+	}
+
+	// Without reloads, nothing is reloaded
+	source = &countingSource{token: "one"}
+	t0 = newSourcedToken(t, source, 0, time.Hour)
+	source.set("two")
+	t0.loaded = time.Now().Add(-minReload)
+	if _, err := t0.Authenticate(tokenRequest("two")); err == nil || source.loads != 1 {
+		t.Errorf("without reloads: got %v after %d loads, want a rejection after 1", err, source.loads)
+	}
+}
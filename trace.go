@@ -14,12 +14,11 @@
 package pprof4svc
 
 import (
+	"fmt"
 	"net/http"
 	"runtime/trace"
 	"sync"
 	"time"
-
-	"github.com/gin-gonic/gin"
 )
 
 // mu is a global mutex to ensure thread-safe access to trace operations.
@@ -27,30 +26,43 @@ var mu = &sync.Mutex{}
 
 // trace handles HTTP requests to the trace control endpoint.
 // It starts a runtime trace for a specified duration and writes the trace data to the HTTP response.
-func trace0(ctx *gin.Context) {
-	// Attempt to acquire the mutex and check if tracing is already active
-	if !mu.TryLock() || trace.IsEnabled() {
-		// Return an error if tracing is already active or the mutex cannot be acquired
-		serveError(ctx.Writer, http.StatusBadRequest, "Tracing is already active")
+// The trace ends early if the request is canceled, e.g. when the client goes away.
+func (p *plugin) trace0(w http.ResponseWriter, r *http.Request) {
+	// Parse the duration query parameter, defaulting to the configured trace duration if not specified
+	dur0, _ := time.ParseDuration(r.URL.Query().Get("dur"))
+	if dur0 <= 0 {
+		dur0 = p.traceDuration
+	}
+	// Refuse traces longer than the configured maximum
+	if p.maxTraceDuration > 0 && dur0 > p.maxTraceDuration {
+		serveError(w, http.StatusBadRequest, fmt.Sprintf("Trace duration exceeds maximum of %s", p.maxTraceDuration))
+		return
+	}
+	// Refuse traces the server would cut off
+	if !writeTimeout(w, r, "Trace", dur0) {
+		return
+	}
+	// Attempt to acquire the mutex, returning an error if another trace holds it
+	if !mu.TryLock() {
+		serveError(w, http.StatusBadRequest, "Tracing is already active")
 		return
 	}
 	// Ensure the mutex is released after the function completes
 	defer mu.Unlock()
-
-	// Get the duration query parameter, defaulting to 10 seconds if not specified
-	dur0str := ctx.Query("dur")
-	if dur0str == "" {
-		dur0str = "10s"
-	}
-	// Parse the duration string into a time.Duration
-	dur0, _ := time.ParseDuration(dur0str)
-	if dur0 == 0 {
-		dur0 = time.Second * 10
+	// Return an error if tracing was started elsewhere, e.g. by the pprof trace endpoint
+	if trace.IsEnabled() {
+		serveError(w, http.StatusBadRequest, "Tracing is already active")
+		return
 	}
 	// Start tracing, writing trace data to the HTTP response writer
-	trace.Start(ctx.Writer)
-	// Wait for the specified duration
-	time.Sleep(dur0)
+	trace.Start(w)
+	// Wait for the specified duration, or until the client goes away or the server shuts down
+	timer := time.NewTimer(dur0)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
 	// Stop tracing
 	trace.Stop()
 }